@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+)
+
+// bootstrapAdmins makes the users in ids admins, recording each promotion in
+// the audit log without an actor. Users that are already admins are left
+// alone, and it returns how many were promoted.
+func bootstrapAdmins(ctx context.Context, db *database.Queries, ids []string) (int, error) {
+	userIDs := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		// Config validation has already checked these parse.
+		userIDs = append(userIDs, uuid.MustParse(id))
+	}
+	promoted, err := db.PromoteUsersToAdmin(ctx, userIDs)
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range promoted {
+		err := db.CreateAuditLogEntry(ctx, database.CreateAuditLogEntryParams{
+			ID:         uuid.New(),
+			CreatedAt:  time.Now().UTC(),
+			Action:     "user.promote",
+			TargetType: "user",
+			TargetID:   uuid.NullUUID{UUID: id, Valid: true},
+			Details:    json.RawMessage(`{"source":"admin.bootstrap_users"}`),
+			Before:     json.RawMessage(`{"is_admin":false}`),
+			After:      json.RawMessage(`{"is_admin":true}`),
+		})
+		if err != nil {
+			return len(promoted), err
+		}
+	}
+	return len(promoted), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+)
+
+// startFeedGC periodically deletes feeds that have had no followers for
+// longer than gracePeriod. Unfollowed feeds stop being scraped straight away,
+// the grace period only gives people a chance to re-follow without losing
+// the feed's posts.
+func startFeedGC(
+	ctx context.Context,
+	stop <-chan struct{},
+	db *database.Queries,
+	interval time.Duration,
+	gracePeriod time.Duration,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		collectOrphanedFeeds(ctx, db, gracePeriod)
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func collectOrphanedFeeds(ctx context.Context, db *database.Queries, gracePeriod time.Duration) {
+	now := time.Now().UTC()
+	err := db.ClearOrphanedFeeds(ctx)
+	if err != nil {
+		log.Printf("Couldn't clear orphaned feeds: %v", err)
+		return
+	}
+	err = db.MarkOrphanedFeeds(ctx, sql.NullTime{Time: now, Valid: true})
+	if err != nil {
+		log.Printf("Couldn't mark orphaned feeds: %v", err)
+		return
+	}
+	deleted, err := db.DeleteOrphanedFeeds(
+		ctx,
+		sql.NullTime{Time: now.Add(-gracePeriod), Valid: true},
+	)
+	if err != nil {
+		log.Printf("Couldn't delete orphaned feeds: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %v feeds without followers", deleted)
+	}
+}
@@ -1,74 +1,283 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
-	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/cors"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 
+	"github.com/AxterDoesCode/blogAggregator/internal/config"
 	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/internal/fetcher"
+	"github.com/AxterDoesCode/blogAggregator/internal/imageproxy"
+	"github.com/AxterDoesCode/blogAggregator/internal/scraper"
 	"github.com/AxterDoesCode/blogAggregator/pkg/apiconfig"
-	httphandler "github.com/AxterDoesCode/blogAggregator/pkg/httpHandler"
+	"github.com/AxterDoesCode/blogAggregator/pkg/ratelimit"
+)
+
+const (
+	modeServe  = "serve"
+	modeScrape = "scrape"
+	modeAll    = "all"
 )
 
 func main() {
+	mode := flag.String(
+		"mode",
+		modeAll,
+		"what to run: serve (API only), scrape (scraper only) or all",
+	)
+	configFile := flag.String(
+		"config",
+		"",
+		"optional YAML config file, settings from the environment override it",
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [serve|scrape|all]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 0 {
+		*mode = flag.Arg(0)
+	}
+	runAPI := *mode == modeServe || *mode == modeAll
+	runScraper := *mode == modeScrape || *mode == modeAll
+	if !runAPI && !runScraper {
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	godotenv.Load()
-	port := os.Getenv("PORT")
-	r := chi.NewRouter()
-	v1Router := chi.NewRouter()
-	dbURL := os.Getenv("GOOSE_DBSTRING")
-	db, err := sql.Open("postgres", dbURL)
+	if *configFile == "" {
+		*configFile = os.Getenv("CONFIG_FILE")
+	}
+	cfg, err := config.Load(*configFile, config.Components{API: runAPI, Scraper: runScraper})
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+
+	// A signal only stops the workers taking on more; the work they've
+	// already started runs on workCtx, which is cancelled once the shutdown
+	// deadline has passed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	db, err := sql.Open("postgres", cfg.Database.URL)
 	if err != nil {
 		log.Fatal(err)
 		return
 	}
+	db.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
 
 	dbQueries := database.New(db)
 
-	apiCfg := apiconfig.ApiConfig{
-		DB: dbQueries,
-	}
-
-	r.Use(cors.Handler(cors.Options{
-		// AllowedOrigins:   []string{"https://foo.com"}, // Use this to allow specific origin hosts
-		AllowedOrigins: []string{"https://*", "http://*"},
-		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"*"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300, // Maximum value not ignored by any of major browsers
-	}))
-	r.Mount("/v1", v1Router)
-	v1Router.Get("/readiness", httphandler.Readiness)
-	v1Router.Get("/err", httphandler.ErrHandler)
-	v1Router.Post("/users", apiCfg.HandleCreateUser)
-	v1Router.Get("/users", apiCfg.MiddlewareAuth(apiCfg.HandleGetUserByApiKey))
-	v1Router.Post("/feeds", apiCfg.MiddlewareAuth(apiCfg.HandleCreateFeed))
-	v1Router.Get("/feeds", apiCfg.HandleGetFeeds)
-	v1Router.Post("/feed_follows", apiCfg.MiddlewareAuth(apiCfg.HandleCreateFeedFollow))
-	v1Router.Delete(
-		"/feed_follows/{feedFollowID}",
-		apiCfg.MiddlewareAuth(apiCfg.HandleDeleteFeedFollow),
-	)
-	v1Router.Get("/feed_follows", apiCfg.MiddlewareAuth(apiCfg.HandleGetFeedFollow))
-	v1Router.Get("/posts", apiCfg.MiddlewareAuth(apiCfg.HandleGetPosts))
+	if len(cfg.Admin.BootstrapUsers) > 0 {
+		promoted, err := bootstrapAdmins(ctx, dbQueries, cfg.Admin.BootstrapUsers)
+		if err != nil {
+			log.Fatalf("Couldn't make the bootstrap users admins: %v", err)
+		}
+		if promoted > 0 {
+			log.Printf("Made %d of admin.bootstrap_users admins", promoted)
+		}
+	}
+
+	var server *http.Server
+	serverErr := make(chan error, 1)
+	workers := &sync.WaitGroup{}
+	if runAPI {
+		var rateLimiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+		if cfg.RateLimit.Backend == "postgres" {
+			rateLimiter = ratelimit.NewPostgresLimiter(dbQueries)
+		}
+		rateLimits := map[string]ratelimit.Limit{}
+		for group, limit := range cfg.RateLimit.Groups {
+			rateLimits[group] = ratelimit.PerMinute(limit.PerMinute, limit.Burst)
+		}
+
+		apiCfg := apiconfig.ApiConfig{
+			DB:          dbQueries,
+			DBConn:      db,
+			RateLimiter: rateLimiter,
+			RateLimits:  rateLimits,
 
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: r,
+			MinPollInterval: cfg.Scraper.MinFeedInterval,
+			MaxPollInterval: cfg.Scraper.MaxFeedInterval,
+		}
+		if cfg.ImageProxy.Secret != "" {
+			apiCfg.ImageProxy = newImageProxy(cfg)
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				apiCfg.ImageProxy.Sweep(ctx, cfg.ImageProxy.SweepInterval)
+			}()
+		}
+
+		server = &http.Server{
+			Addr:              ":" + cfg.Server.Port,
+			Handler:           newRouter(&apiCfg, cfg),
+			ReadTimeout:       cfg.Server.ReadTimeout,
+			ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			WriteTimeout:      cfg.Server.WriteTimeout,
+			IdleTimeout:       cfg.Server.IdleTimeout,
+		}
+		go func() {
+			log.Printf("Serving on port : %s\n", cfg.Server.Port)
+			serverErr <- server.ListenAndServe()
+		}()
 	}
 
-	const collectionConcurrency = 10
-	const collectionInterval = time.Minute
-	go startScraping(dbQueries, collectionConcurrency, collectionInterval)
+	if runScraper {
+		startWorkers(workCtx, ctx.Done(), workers, db, dbQueries, cfg.Scraper)
+	}
 
-	log.Printf("Serving on port : %s\n", port)
-	log.Fatal(server.ListenAndServe())
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	case <-ctx.Done():
+	}
+	stop()
+	log.Printf("Shutting down, waiting up to %s for in-flight work", cfg.Server.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if server != nil {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Couldn't drain HTTP server: %v", err)
+		}
+	}
+	if !waitWithContext(shutdownCtx, workers) {
+		log.Println("Background workers didn't finish before the shutdown deadline, cancelling them")
+		cancelWork()
+		// Give them a moment to hand their leases back.
+		releaseCtx, cancelRelease := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelRelease()
+		waitWithContext(releaseCtx, workers)
+	}
+	db.Close()
+	log.Println("Shutdown complete")
+}
+
+// startWorkers runs the scraper, article extraction and feed garbage
+// collection until stop is closed, tracking them in workers. Their database
+// work and fetches run on ctx.
+func startWorkers(
+	ctx context.Context,
+	stop <-chan struct{},
+	workers *sync.WaitGroup,
+	db *sql.DB,
+	dbQueries *database.Queries,
+	cfg config.ScraperConfig,
+) {
+	feedFetcher, err := fetcher.New(fetcher.Options{
+		Timeout:         cfg.FetchTimeout,
+		UserAgent:       cfg.UserAgent,
+		MaxBodyBytes:    cfg.MaxBodyBytes,
+		MaxRedirects:    cfg.MaxRedirects,
+		AllowedHosts:    cfg.AllowedHosts,
+		AllowedNetworks: cfg.AllowedNetworks,
+		AllowedPorts:    cfg.AllowedPorts,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	feedScraper := scraper.Scraper{
+		DB:            dbQueries,
+		DBConn:        db,
+		WorkerID:      scraper.NewWorkerID(),
+		Workers:       cfg.Workers,
+		PollInterval:  cfg.PollInterval,
+		LeaseDuration: cfg.LeaseDuration,
+		Intervals: scraper.IntervalPolicy{
+			Min: cfg.MinFeedInterval,
+			Max: cfg.MaxFeedInterval,
+		},
+		Fetcher: feedFetcher,
+	}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		feedScraper.Run(ctx, stop)
+	}()
+
+	extractor := scraper.Extractor{
+		DB:            dbQueries,
+		Fetcher:       feedFetcher,
+		Workers:       cfg.ExtractionWorkers,
+		PollInterval:  cfg.PollInterval,
+		LeaseDuration: cfg.LeaseDuration,
+		RetryDelay:    cfg.ExtractionRetryDelay,
+		MaxAttempts:   cfg.ExtractionMaxAttempts,
+	}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		extractor.Run(ctx, stop)
+	}()
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		startFeedGC(ctx, stop, dbQueries, cfg.FeedGCInterval, cfg.OrphanedFeedGracePeriod)
+	}()
+}
+
+// newImageProxy builds the image proxy, fetching with the scraper's user agent
+// and address allowlists.
+func newImageProxy(cfg config.Config) *imageproxy.Proxy {
+	imageFetcher, err := fetcher.New(fetcher.Options{
+		Timeout:         cfg.ImageProxy.FetchTimeout,
+		UserAgent:       cfg.Scraper.UserAgent,
+		MaxBodyBytes:    cfg.ImageProxy.MaxBytes,
+		MaxRedirects:    cfg.Scraper.MaxRedirects,
+		AllowedHosts:    cfg.Scraper.AllowedHosts,
+		AllowedNetworks: cfg.Scraper.AllowedNetworks,
+		AllowedPorts:    cfg.Scraper.AllowedPorts,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	proxy, err := imageproxy.New(imageproxy.Options{
+		Secret:   cfg.ImageProxy.Secret,
+		BaseURL:  cfg.ImageProxy.BaseURL,
+		CacheDir: cfg.ImageProxy.CacheDir,
+		CacheTTL: cfg.ImageProxy.CacheTTL,
+		Fetcher:  imageFetcher,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return proxy
+}
+
+// waitWithContext waits for wg, giving up when ctx is done. It reports whether
+// everything finished in time.
+func waitWithContext(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
@@ -15,7 +15,7 @@ type Feed struct {
 	UpdatedAt     time.Time  `json:"updated_at"`
 	Name          string     `json:"name"`
 	Url           string     `json:"url"`
-	UserID        uuid.UUID  `json:"user_id"`
+	CreatedBy     *uuid.UUID `json:"created_by"`
 	LastFetchedAt *time.Time `json:"last_fetched_at"`
 }
 
@@ -26,7 +26,7 @@ func databaseFeedtoFeed(dbf database.Feed) Feed {
 		UpdatedAt:     dbf.UpdatedAt,
 		Name:          dbf.Name,
 		Url:           dbf.Url,
-		UserID:        dbf.UserID,
+		CreatedBy:     convertNullUUID(dbf.CreatedBy),
 		LastFetchedAt: convertNullTime(dbf.LastFetchedAt),
 	}
 }
@@ -37,3 +37,10 @@ func convertNullTime(sqlTime sql.NullTime) *time.Time {
 	}
 	return nil
 }
+
+func convertNullUUID(id uuid.NullUUID) *uuid.UUID {
+	if id.Valid {
+		return &id.UUID
+	}
+	return nil
+}
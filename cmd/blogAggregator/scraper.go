@@ -1,134 +0,0 @@
-package main
-
-import (
-	"context"
-	"database/sql"
-	"encoding/xml"
-	"io"
-	"log"
-	"net/http"
-	"strings"
-	"sync"
-	"time"
-
-	"github.com/google/uuid"
-
-	"github.com/AxterDoesCode/blogAggregator/internal/database"
-)
-
-type RSSFeed struct {
-	Channel struct {
-		Title       string    `xml:"title"`
-		Link        string    `xml:"link"`
-		Description string    `xml:"description"`
-		Language    string    `xml:"language"`
-		Item        []RSSItem `xml:"item"`
-	} `xml:"channel"`
-}
-
-type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pub_date"`
-}
-
-func startScraping(db *database.Queries, concurrency int, timeBetweenRequest time.Duration) {
-	ticker := time.NewTicker(timeBetweenRequest)
-	log.Printf(
-		"Starting scraping, collecting feeds every %s on %v routines",
-		timeBetweenRequest,
-		concurrency,
-	)
-
-	for ; ; <-ticker.C {
-		feeds, err := db.GetNextFeedsToFetch(context.Background(), int32(concurrency))
-		if err != nil {
-			log.Println("Couldn't get feeds to fetch")
-			continue
-		}
-		log.Printf("Found %v feeds to fetch", len(feeds))
-
-		waitGroup := &sync.WaitGroup{}
-		for _, feed := range feeds {
-			waitGroup.Add(1)
-			go scrapeFeed(db, waitGroup, feed)
-		}
-		waitGroup.Wait()
-	}
-}
-
-func scrapeFeed(db *database.Queries, wg *sync.WaitGroup, feed database.Feed) {
-	defer wg.Done()
-	_, err := db.MarkFeedFetched(context.Background(), feed.ID)
-	if err != nil {
-		log.Printf("Couldn't mark feed %s fetched: %v", feed.Name, err)
-		return
-	}
-
-	feedData, err := fetchFeed(feed.Url)
-	if err != nil {
-		log.Printf("Couldn't fetch feed %s: %v", feed.Name, err)
-		return
-	}
-
-	for _, item := range feedData.Channel.Item {
-		log.Println("Found post", item.Title)
-		publishedAt := sql.NullTime{}
-		t, err := time.Parse(time.RFC1123, item.PubDate)
-		if err == nil {
-			publishedAt = sql.NullTime{
-				Time:  t,
-				Valid: true,
-			}
-		}
-		_, err = db.CreatePost(context.Background(), database.CreatePostParams{
-			ID:          uuid.New(),
-			CreatedAt:   time.Now().UTC(),
-			UpdatedAt:   time.Now().UTC(),
-			Title:       item.Title,
-			Url:         item.Link,
-			Description: item.Description,
-			PublishedAt: publishedAt,
-			FeedID:      feed.ID,
-		})
-
-		if err != nil {
-			if strings.Contains(err.Error(), "duplicate key violates unique constraint") {
-				continue
-			}
-			log.Printf("Couldn't create post: %v", err)
-			continue
-		}
-
-	}
-	log.Printf("Feed %s collected, %v posts found", feed.Name, len(feedData.Channel.Item))
-}
-
-func fetchFeed(url string) (*RSSFeed, error) {
-	httpclient := http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := httpclient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	dat, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var rssFeed RSSFeed
-	err = xml.Unmarshal(dat, &rssFeed)
-	if err != nil {
-		return nil, err
-	}
-	return &rssFeed, nil
-}
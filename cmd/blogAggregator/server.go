@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/config"
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/pkg/apiconfig"
+	httphandler "github.com/AxterDoesCode/blogAggregator/pkg/httpHandler"
+)
+
+func newRouter(apiCfg *apiconfig.ApiConfig, cfg config.Config) http.Handler {
+	r := chi.NewRouter()
+	v1Router := chi.NewRouter()
+
+	// Admin routes get their own rate limit group, checked before the admin
+	// check so guessing at them is limited too.
+	adminOnly := func(
+		handler func(http.ResponseWriter, *http.Request, database.User),
+	) http.HandlerFunc {
+		return apiCfg.MiddlewareAuth(
+			apiCfg.MiddlewareRateLimit("admin", apiCfg.MiddlewareAdmin(handler)),
+		)
+	}
+
+	r.Use(middleware.RequestID)
+	r.Use(cors.Handler(cors.Options{
+		AllowedOrigins: cfg.CORS.AllowedOrigins,
+		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{
+			"Link",
+			"RateLimit-Limit",
+			"RateLimit-Remaining",
+			"RateLimit-Reset",
+			"Retry-After",
+		},
+		AllowCredentials: false,
+		MaxAge:           300, // Maximum value not ignored by any of major browsers
+	}))
+	r.Use(httphandler.MaxBodyBytes(cfg.Server.MaxBodyBytes))
+	r.Mount("/v1", v1Router)
+	v1Router.Get("/readiness", httphandler.Readiness)
+	v1Router.Get("/err", httphandler.ErrHandler)
+	v1Router.Post("/users", apiCfg.MiddlewareRateLimitIP("signup", apiCfg.HandleCreateUser))
+	v1Router.Get(
+		"/users",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("read", apiCfg.HandleGetUserByApiKey)),
+	)
+	v1Router.Patch(
+		"/users",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("write", apiCfg.HandleUpdateUser)),
+	)
+	v1Router.Delete(
+		"/users",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("write", apiCfg.HandleDeleteUser)),
+	)
+	v1Router.Get(
+		"/users/export",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("read", apiCfg.HandleExportUser)),
+	)
+	v1Router.Post(
+		"/feeds",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("write", apiCfg.HandleCreateFeed)),
+	)
+	v1Router.Get(
+		"/feeds",
+		apiCfg.MiddlewareRateLimitIP("read", apiCfg.MiddlewareOptionalAuth(apiCfg.HandleGetFeeds)),
+	)
+	v1Router.Patch(
+		"/feeds/{feedID}",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("write", apiCfg.HandleUpdateFeed)),
+	)
+	v1Router.Delete(
+		"/feeds/{feedID}",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("write", apiCfg.HandleDeleteFeed)),
+	)
+	v1Router.Put(
+		"/feeds/{feedID}/full_content",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("write", apiCfg.HandleSetFeedFullContent)),
+	)
+	v1Router.Post(
+		"/subscriptions",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("write", apiCfg.HandleSubscribe)),
+	)
+	v1Router.Post(
+		"/feed_follows",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("write", apiCfg.HandleCreateFeedFollow)),
+	)
+	v1Router.Patch(
+		"/feed_follows/{feedFollowID}",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("write", apiCfg.HandleUpdateFeedFollow)),
+	)
+	v1Router.Delete(
+		"/feed_follows/{feedFollowID}",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("write", apiCfg.HandleDeleteFeedFollow)),
+	)
+	v1Router.Get(
+		"/feed_follows",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("read", apiCfg.HandleGetFeedFollow)),
+	)
+	v1Router.Get(
+		"/posts",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("read", apiCfg.HandleGetPosts)),
+	)
+	v1Router.Get(
+		"/posts/{postID}/playback",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("read", apiCfg.HandleGetPlaybackPosition)),
+	)
+	v1Router.Put(
+		"/posts/{postID}/playback",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("write", apiCfg.HandleSetPlaybackPosition)),
+	)
+	v1Router.Get(
+		"/images/{signature}",
+		apiCfg.MiddlewareRateLimitIP("images", apiCfg.HandleGetImage),
+	)
+	v1Router.Get("/audit", adminOnly(apiCfg.HandleGetAuditLog))
+	v1Router.Get(
+		"/audit/me",
+		apiCfg.MiddlewareAuth(apiCfg.MiddlewareRateLimit("read", apiCfg.HandleGetOwnAuditLog)),
+	)
+
+	adminRouter := chi.NewRouter()
+	adminRouter.Get("/users", adminOnly(apiCfg.HandleAdminListUsers))
+	adminRouter.Post("/users/{userID}/disable", adminOnly(apiCfg.HandleAdminDisableUser))
+	adminRouter.Post("/users/{userID}/enable", adminOnly(apiCfg.HandleAdminEnableUser))
+	adminRouter.Post("/feeds/{feedID}/refetch", adminOnly(apiCfg.HandleAdminRefetchFeed))
+	adminRouter.Post("/feeds/{feedID}/disable", adminOnly(apiCfg.HandleAdminDisableFeed))
+	adminRouter.Post("/feeds/{feedID}/enable", adminOnly(apiCfg.HandleAdminEnableFeed))
+	adminRouter.Post("/feeds/{feedID}/merge", adminOnly(apiCfg.HandleAdminMergeFeeds))
+	adminRouter.Delete("/posts/{postID}", adminOnly(apiCfg.HandleAdminDeletePost))
+	adminRouter.Get("/scraper", adminOnly(apiCfg.HandleAdminGetScraperStatus))
+	v1Router.Mount("/admin", adminRouter)
+
+	return r
+}
@@ -10,4 +10,12 @@ require github.com/go-chi/cors v1.2.1
 
 require github.com/google/uuid v1.3.0
 
-require github.com/lib/pq v1.10.9 // indirect
+require github.com/lib/pq v1.10.9
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require github.com/andybalholm/brotli v1.1.0
+
+require golang.org/x/net v0.35.0
+
+require golang.org/x/text v0.22.0 // indirect
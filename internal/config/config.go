@@ -0,0 +1,356 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is loaded from defaults, then an optional YAML file, then the
+// environment, each overriding the last. Fields tagged env can be set from
+// the named variable; lists are comma separated and durations use Go's
+// syntax, e.g. "90s".
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	CORS       CORSConfig       `yaml:"cors"`
+	RateLimit  RateLimitConfig  `yaml:"rate_limit"`
+	Scraper    ScraperConfig    `yaml:"scraper"`
+	ImageProxy ImageProxyConfig `yaml:"image_proxy"`
+	Admin      AdminConfig      `yaml:"admin"`
+}
+
+type ServerConfig struct {
+	Port              string        `yaml:"port" env:"PORT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	MaxBodyBytes      int64         `yaml:"max_body_bytes" env:"SERVER_MAX_BODY_BYTES"`
+}
+
+type DatabaseConfig struct {
+	URL             string        `yaml:"url" env:"GOOSE_DBSTRING"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+}
+
+type RateLimitConfig struct {
+	Backend string                    `yaml:"backend" env:"RATE_LIMIT_BACKEND"`
+	Groups  map[string]RateLimitGroup `yaml:"groups"`
+}
+
+type RateLimitGroup struct {
+	PerMinute int `yaml:"per_minute"`
+	Burst     int `yaml:"burst"`
+}
+
+type ScraperConfig struct {
+	Workers                 int           `yaml:"workers" env:"SCRAPER_WORKERS"`
+	PollInterval            time.Duration `yaml:"poll_interval" env:"SCRAPER_POLL_INTERVAL"`
+	LeaseDuration           time.Duration `yaml:"lease_duration" env:"SCRAPER_LEASE_DURATION"`
+	MinFeedInterval         time.Duration `yaml:"min_feed_interval" env:"SCRAPER_MIN_FEED_INTERVAL"`
+	MaxFeedInterval         time.Duration `yaml:"max_feed_interval" env:"SCRAPER_MAX_FEED_INTERVAL"`
+	FetchTimeout            time.Duration `yaml:"fetch_timeout" env:"SCRAPER_FETCH_TIMEOUT"`
+	UserAgent               string        `yaml:"user_agent" env:"SCRAPER_USER_AGENT"`
+	MaxBodyBytes            int64         `yaml:"max_body_bytes" env:"SCRAPER_MAX_BODY_BYTES"`
+	MaxRedirects            int           `yaml:"max_redirects" env:"SCRAPER_MAX_REDIRECTS"`
+	FeedGCInterval          time.Duration `yaml:"feed_gc_interval" env:"SCRAPER_FEED_GC_INTERVAL"`
+	OrphanedFeedGracePeriod time.Duration `yaml:"orphaned_feed_grace_period" env:"SCRAPER_ORPHANED_FEED_GRACE_PERIOD"`
+	ExtractionWorkers       int           `yaml:"extraction_workers" env:"SCRAPER_EXTRACTION_WORKERS"`
+	ExtractionMaxAttempts   int           `yaml:"extraction_max_attempts" env:"SCRAPER_EXTRACTION_MAX_ATTEMPTS"`
+	ExtractionRetryDelay    time.Duration `yaml:"extraction_retry_delay" env:"SCRAPER_EXTRACTION_RETRY_DELAY"`
+	// The fetcher refuses internal addresses and ports other than 80 and 443,
+	// these open it up for intranet feeds.
+	AllowedHosts    []string `yaml:"allowed_hosts" env:"SCRAPER_ALLOWED_HOSTS"`
+	AllowedNetworks []string `yaml:"allowed_networks" env:"SCRAPER_ALLOWED_NETWORKS"`
+	AllowedPorts    []int    `yaml:"allowed_ports" env:"SCRAPER_ALLOWED_PORTS"`
+}
+
+// ImageProxyConfig configures the proxy images in post content are served
+// through. It's off unless a secret is set. Images are fetched with the
+// scraper's user agent and address allowlists.
+type ImageProxyConfig struct {
+	Secret        string        `yaml:"secret" env:"IMAGE_PROXY_SECRET"`
+	BaseURL       string        `yaml:"base_url" env:"IMAGE_PROXY_BASE_URL"`
+	CacheDir      string        `yaml:"cache_dir" env:"IMAGE_PROXY_CACHE_DIR"`
+	CacheTTL      time.Duration `yaml:"cache_ttl" env:"IMAGE_PROXY_CACHE_TTL"`
+	SweepInterval time.Duration `yaml:"sweep_interval" env:"IMAGE_PROXY_SWEEP_INTERVAL"`
+	MaxBytes      int64         `yaml:"max_bytes" env:"IMAGE_PROXY_MAX_BYTES"`
+	FetchTimeout  time.Duration `yaml:"fetch_timeout" env:"IMAGE_PROXY_FETCH_TIMEOUT"`
+}
+
+// AdminConfig sets up the first admins. Admins can't be made through the API,
+// so the users listed by ID in BootstrapUsers are made admins at startup.
+type AdminConfig struct {
+	BootstrapUsers []string `yaml:"bootstrap_users" env:"ADMIN_BOOTSTRAP_USERS"`
+}
+
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			MaxBodyBytes:      1 << 20,
+		},
+		Database: DatabaseConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"https://*", "http://*"},
+		},
+		RateLimit: RateLimitConfig{
+			Backend: "memory",
+			Groups: map[string]RateLimitGroup{
+				"signup": {PerMinute: 5, Burst: 5},
+				"write":  {PerMinute: 20, Burst: 10},
+				"read":   {PerMinute: 120, Burst: 30},
+				"images": {PerMinute: 600, Burst: 100},
+				"admin":  {PerMinute: 60, Burst: 20},
+			},
+		},
+		Scraper: ScraperConfig{
+			Workers:                 10,
+			PollInterval:            10 * time.Second,
+			LeaseDuration:           5 * time.Minute,
+			MinFeedInterval:         5 * time.Minute,
+			MaxFeedInterval:         24 * time.Hour,
+			FetchTimeout:            10 * time.Second,
+			UserAgent:               "blogAggregator/1.0 (+https://github.com/AxterDoesCode/blogAggregator)",
+			MaxBodyBytes:            10 << 20,
+			MaxRedirects:            5,
+			FeedGCInterval:          time.Hour,
+			OrphanedFeedGracePeriod: 7 * 24 * time.Hour,
+			ExtractionWorkers:       2,
+			ExtractionMaxAttempts:   3,
+			ExtractionRetryDelay:    time.Hour,
+		},
+		ImageProxy: ImageProxyConfig{
+			CacheDir:      filepath.Join(os.TempDir(), "blogAggregator-images"),
+			CacheTTL:      7 * 24 * time.Hour,
+			SweepInterval: time.Hour,
+			MaxBytes:      5 << 20,
+			FetchTimeout:  10 * time.Second,
+		},
+	}
+}
+
+// Load builds the configuration, reading path as YAML when it isn't empty,
+// and validates the result for the components that will run.
+func Load(path string, run Components) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		dat, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := yaml.Unmarshal(dat, &cfg); err != nil {
+			return cfg, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+	if err := applyEnv(reflect.ValueOf(&cfg).Elem()); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate(run)
+}
+
+func applyEnv(v reflect.Value) error {
+	var errs []error
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := applyEnv(field); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		name := t.Field(i).Tag.Get("env")
+		raw, ok := os.LookupEnv(name)
+		if name == "" || !ok || raw == "" {
+			continue
+		}
+		if err := setFromString(field, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setFromString(field reflect.Value, raw string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		items := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := setFromString(elem, item); err != nil {
+				return err
+			}
+			items = reflect.Append(items, elem)
+		}
+		field.Set(items)
+	default:
+		return fmt.Errorf("unsupported config type %s", field.Type())
+	}
+	return nil
+}
+
+// Components says which parts of the program a process runs, as settings are
+// only checked for the parts that use them.
+type Components struct {
+	API     bool
+	Scraper bool
+}
+
+// Validate reports every problem with the configuration at once.
+func (cfg Config) Validate(run Components) error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	checkPositive := func(durations map[string]time.Duration) {
+		for name, d := range durations {
+			check(d > 0, "%s must be positive", name)
+		}
+	}
+
+	check(cfg.Database.URL != "", "database.url (GOOSE_DBSTRING) must be set")
+	check(cfg.Database.MaxOpenConns > 0, "database.max_open_conns must be positive")
+	check(cfg.Database.MaxIdleConns >= 0, "database.max_idle_conns can't be negative")
+	check(cfg.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime can't be negative")
+
+	// The API bounds the poll intervals followers ask for by these too.
+	checkPositive(map[string]time.Duration{
+		"scraper.min_feed_interval": cfg.Scraper.MinFeedInterval,
+	})
+	check(cfg.Scraper.MaxFeedInterval >= cfg.Scraper.MinFeedInterval,
+		"scraper.max_feed_interval must be at least scraper.min_feed_interval")
+
+	for _, id := range cfg.Admin.BootstrapUsers {
+		_, err := uuid.Parse(id)
+		check(err == nil, "admin.bootstrap_users: %q isn't a user ID", id)
+	}
+
+	if run.API {
+		port, err := strconv.Atoi(cfg.Server.Port)
+		check(cfg.Server.Port != "", "server.port (PORT) must be set")
+		check(cfg.Server.Port == "" || (err == nil && port > 0 && port < 65536),
+			"server.port (PORT) must be a port number, got %q", cfg.Server.Port)
+		checkPositive(map[string]time.Duration{
+			"server.read_timeout":        cfg.Server.ReadTimeout,
+			"server.read_header_timeout": cfg.Server.ReadHeaderTimeout,
+			"server.write_timeout":       cfg.Server.WriteTimeout,
+			"server.idle_timeout":        cfg.Server.IdleTimeout,
+		})
+		check(cfg.Server.MaxBodyBytes > 0, "server.max_body_bytes must be positive")
+
+		check(len(cfg.CORS.AllowedOrigins) > 0,
+			"cors.allowed_origins must list at least one origin")
+
+		check(cfg.RateLimit.Backend == "memory" || cfg.RateLimit.Backend == "postgres",
+			"rate_limit.backend must be memory or postgres, got %q", cfg.RateLimit.Backend)
+		for name, group := range cfg.RateLimit.Groups {
+			check(group.PerMinute > 0 && group.Burst > 0,
+				"rate_limit.groups.%s needs a positive per_minute and burst", name)
+		}
+
+		if cfg.ImageProxy.Secret != "" {
+			check(len(cfg.ImageProxy.Secret) >= 32,
+				"image_proxy.secret (IMAGE_PROXY_SECRET) must be at least 32 characters")
+			check(cfg.ImageProxy.CacheDir != "", "image_proxy.cache_dir must be set")
+			checkPositive(map[string]time.Duration{
+				"image_proxy.cache_ttl":      cfg.ImageProxy.CacheTTL,
+				"image_proxy.sweep_interval": cfg.ImageProxy.SweepInterval,
+				"image_proxy.fetch_timeout":  cfg.ImageProxy.FetchTimeout,
+			})
+			check(cfg.ImageProxy.MaxBytes > 0, "image_proxy.max_bytes must be positive")
+		}
+	}
+
+	// Shutdown waits for requests and workers alike.
+	checkPositive(map[string]time.Duration{
+		"server.shutdown_timeout": cfg.Server.ShutdownTimeout,
+	})
+
+	// The image proxy fetches with the scraper's user agent and allowlists.
+	if run.Scraper || (run.API && cfg.ImageProxy.Secret != "") {
+		check(cfg.Scraper.UserAgent != "", "scraper.user_agent must be set")
+		check(cfg.Scraper.MaxRedirects >= 0, "scraper.max_redirects can't be negative")
+		for _, cidr := range cfg.Scraper.AllowedNetworks {
+			_, _, err := net.ParseCIDR(cidr)
+			check(err == nil, "scraper.allowed_networks: %q isn't a CIDR range", cidr)
+		}
+		for _, port := range cfg.Scraper.AllowedPorts {
+			check(port > 0 && port < 65536, "scraper.allowed_ports: %d isn't a port", port)
+		}
+	}
+
+	if run.Scraper {
+		checkPositive(map[string]time.Duration{
+			"scraper.poll_interval":    cfg.Scraper.PollInterval,
+			"scraper.lease_duration":   cfg.Scraper.LeaseDuration,
+			"scraper.fetch_timeout":    cfg.Scraper.FetchTimeout,
+			"scraper.feed_gc_interval": cfg.Scraper.FeedGCInterval,
+		})
+		check(cfg.Scraper.Workers > 0, "scraper.workers must be positive")
+		check(cfg.Scraper.LeaseDuration > cfg.Scraper.FetchTimeout,
+			"scraper.lease_duration must be longer than scraper.fetch_timeout")
+		check(cfg.Scraper.MaxBodyBytes > 0, "scraper.max_body_bytes must be positive")
+		check(cfg.Scraper.ExtractionWorkers > 0, "scraper.extraction_workers must be positive")
+		check(cfg.Scraper.ExtractionMaxAttempts > 0,
+			"scraper.extraction_max_attempts must be positive")
+		check(cfg.Scraper.ExtractionRetryDelay >= 0,
+			"scraper.extraction_retry_delay can't be negative")
+		check(cfg.Scraper.OrphanedFeedGracePeriod >= 0,
+			"scraper.orphaned_feed_grace_period can't be negative")
+	}
+
+	return errors.Join(errs...)
+}
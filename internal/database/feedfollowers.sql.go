@@ -7,12 +7,78 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-const createFeedFollow = `-- name: CreateFeedFollow :one
+const countOtherFeedFollowers = `-- name: CountOtherFeedFollowers :one
+SELECT COUNT(*) FROM feed_follows
+WHERE feed_id = $1 AND user_id <> $2
+`
+
+type CountOtherFeedFollowersParams struct {
+	FeedID uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) CountOtherFeedFollowers(ctx context.Context, arg CountOtherFeedFollowersParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countOtherFeedFollowers, arg.FeedID, arg.UserID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteFeedFollow = `-- name: DeleteFeedFollow :one
+DELETE FROM feed_follows WHERE id = $1 and user_id = $2
+RETURNING id, feed_id, user_id, created_at, updated_at, poll_interval_seconds
+`
+
+type DeleteFeedFollowParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowParams) (FeedFollow, error) {
+	row := q.db.QueryRowContext(ctx, deleteFeedFollow, arg.ID, arg.UserID)
+	var i FeedFollow
+	err := row.Scan(
+		&i.ID,
+		&i.FeedID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PollIntervalSeconds,
+	)
+	return i, err
+}
+
+const deleteFeedFollowByFeed = `-- name: DeleteFeedFollowByFeed :one
+DELETE FROM feed_follows WHERE feed_id = $1 AND user_id = $2
+RETURNING id, feed_id, user_id, created_at, updated_at, poll_interval_seconds
+`
+
+type DeleteFeedFollowByFeedParams struct {
+	FeedID uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) DeleteFeedFollowByFeed(ctx context.Context, arg DeleteFeedFollowByFeedParams) (FeedFollow, error) {
+	row := q.db.QueryRowContext(ctx, deleteFeedFollowByFeed, arg.FeedID, arg.UserID)
+	var i FeedFollow
+	err := row.Scan(
+		&i.ID,
+		&i.FeedID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PollIntervalSeconds,
+	)
+	return i, err
+}
+
+const followFeed = `-- name: FollowFeed :one
 INSERT INTO feed_follows (id, feed_id, user_id, created_at, updated_at)
 VALUES (
   $1,
@@ -21,10 +87,12 @@ VALUES (
   $4,
   $5
   )
-RETURNING id, feed_id, user_id, created_at, updated_at
+ON CONFLICT (feed_id, user_id) DO UPDATE
+SET updated_at = feed_follows.updated_at
+RETURNING id, feed_id, user_id, created_at, updated_at, poll_interval_seconds
 `
 
-type CreateFeedFollowParams struct {
+type FollowFeedParams struct {
 	ID        uuid.UUID
 	FeedID    uuid.UUID
 	UserID    uuid.UUID
@@ -32,8 +100,8 @@ type CreateFeedFollowParams struct {
 	UpdatedAt time.Time
 }
 
-func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowParams) (FeedFollow, error) {
-	row := q.db.QueryRowContext(ctx, createFeedFollow,
+func (q *Queries) FollowFeed(ctx context.Context, arg FollowFeedParams) (FeedFollow, error) {
+	row := q.db.QueryRowContext(ctx, followFeed,
 		arg.ID,
 		arg.FeedID,
 		arg.UserID,
@@ -47,26 +115,13 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 		&i.UserID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.PollIntervalSeconds,
 	)
 	return i, err
 }
 
-const deleteFeedFollow = `-- name: DeleteFeedFollow :exec
-DELETE FROM feed_follows WHERE id = $1 and user_id = $2
-`
-
-type DeleteFeedFollowParams struct {
-	ID     uuid.UUID
-	UserID uuid.UUID
-}
-
-func (q *Queries) DeleteFeedFollow(ctx context.Context, arg DeleteFeedFollowParams) error {
-	_, err := q.db.ExecContext(ctx, deleteFeedFollow, arg.ID, arg.UserID)
-	return err
-}
-
 const getFeedFollows = `-- name: GetFeedFollows :many
-SELECT id, feed_id, user_id, created_at, updated_at FROM feed_follows WHERE user_id = $1
+SELECT id, feed_id, user_id, created_at, updated_at, poll_interval_seconds FROM feed_follows WHERE user_id = $1
 `
 
 func (q *Queries) GetFeedFollows(ctx context.Context, userID uuid.UUID) ([]FeedFollow, error) {
@@ -84,6 +139,57 @@ func (q *Queries) GetFeedFollows(ctx context.Context, userID uuid.UUID) ([]FeedF
 			&i.UserID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.PollIntervalSeconds,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFeedFollowsWithFeeds = `-- name: GetFeedFollowsWithFeeds :many
+SELECT feed_follows.id, feed_follows.feed_id, feed_follows.user_id, feed_follows.created_at, feed_follows.updated_at, feed_follows.poll_interval_seconds, feeds.name AS feed_name, feeds.url AS feed_url FROM feed_follows
+JOIN feeds ON feeds.id = feed_follows.feed_id
+WHERE feed_follows.user_id = $1
+ORDER BY feed_follows.created_at ASC
+`
+
+type GetFeedFollowsWithFeedsRow struct {
+	ID                  uuid.UUID
+	FeedID              uuid.UUID
+	UserID              uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	PollIntervalSeconds sql.NullInt32
+	FeedName            string
+	FeedUrl             string
+}
+
+func (q *Queries) GetFeedFollowsWithFeeds(ctx context.Context, userID uuid.UUID) ([]GetFeedFollowsWithFeedsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedFollowsWithFeeds, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFeedFollowsWithFeedsRow
+	for rows.Next() {
+		var i GetFeedFollowsWithFeedsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FeedID,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.PollIntervalSeconds,
+			&i.FeedName,
+			&i.FeedUrl,
 		); err != nil {
 			return nil, err
 		}
@@ -97,3 +203,44 @@ func (q *Queries) GetFeedFollows(ctx context.Context, userID uuid.UUID) ([]FeedF
 	}
 	return items, nil
 }
+
+const getFeedPollIntervalOverride = `-- name: GetFeedPollIntervalOverride :one
+SELECT COALESCE(MIN(poll_interval_seconds), 0)::integer AS poll_interval_seconds
+FROM feed_follows
+WHERE feed_id = $1
+`
+
+func (q *Queries) GetFeedPollIntervalOverride(ctx context.Context, feedID uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, getFeedPollIntervalOverride, feedID)
+	var poll_interval_seconds int32
+	err := row.Scan(&poll_interval_seconds)
+	return poll_interval_seconds, err
+}
+
+const setFeedFollowPollInterval = `-- name: SetFeedFollowPollInterval :one
+UPDATE feed_follows
+SET poll_interval_seconds = $3,
+updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING id, feed_id, user_id, created_at, updated_at, poll_interval_seconds
+`
+
+type SetFeedFollowPollIntervalParams struct {
+	ID                  uuid.UUID
+	UserID              uuid.UUID
+	PollIntervalSeconds sql.NullInt32
+}
+
+func (q *Queries) SetFeedFollowPollInterval(ctx context.Context, arg SetFeedFollowPollIntervalParams) (FeedFollow, error) {
+	row := q.db.QueryRowContext(ctx, setFeedFollowPollInterval, arg.ID, arg.UserID, arg.PollIntervalSeconds)
+	var i FeedFollow
+	err := row.Scan(
+		&i.ID,
+		&i.FeedID,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.PollIntervalSeconds,
+	)
+	return i, err
+}
@@ -7,13 +7,163 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
+const bringForwardFeedFetch = `-- name: BringForwardFeedFetch :exec
+UPDATE feeds
+SET next_fetch_at = LEAST(
+  COALESCE(next_fetch_at, NOW()),
+  COALESCE(last_fetched_at, NOW()) + $1::float8 * INTERVAL '1 second'
+)
+WHERE id = $2
+`
+
+type BringForwardFeedFetchParams struct {
+	IntervalSeconds float64
+	ID              uuid.UUID
+}
+
+func (q *Queries) BringForwardFeedFetch(ctx context.Context, arg BringForwardFeedFetchParams) error {
+	_, err := q.db.ExecContext(ctx, bringForwardFeedFetch, arg.IntervalSeconds, arg.ID)
+	return err
+}
+
+const claimDueFeeds = `-- name: ClaimDueFeeds :many
+UPDATE feeds
+SET lease_owner = $1,
+lease_expires_at = NOW() + $2::float8 * INTERVAL '1 second'
+WHERE id IN (
+  SELECT id FROM feeds
+  WHERE disabled_at IS NULL
+  AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+  AND (lease_expires_at IS NULL OR lease_expires_at <= NOW())
+  AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+  ORDER BY next_fetch_at ASC NULLS FIRST
+  LIMIT $3
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, created_by, last_fetched_at, orphaned_at, disabled_at, last_fetch_error, fetch_interval_seconds, next_fetch_at, lease_owner, lease_expires_at, encoding, last_parse_repair, fetch_full_content
+`
+
+type ClaimDueFeedsParams struct {
+	WorkerID     sql.NullString
+	LeaseSeconds float64
+	MaxFeeds     int32
+}
+
+func (q *Queries) ClaimDueFeeds(ctx context.Context, arg ClaimDueFeedsParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimDueFeeds, arg.WorkerID, arg.LeaseSeconds, arg.MaxFeeds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.CreatedBy,
+			&i.LastFetchedAt,
+			&i.OrphanedAt,
+			&i.DisabledAt,
+			&i.LastFetchError,
+			&i.FetchIntervalSeconds,
+			&i.NextFetchAt,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Encoding,
+			&i.LastParseRepair,
+			&i.FetchFullContent,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const clearOrphanedFeeds = `-- name: ClearOrphanedFeeds :exec
+UPDATE feeds
+SET orphaned_at = NULL
+WHERE orphaned_at IS NOT NULL
+AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+`
+
+func (q *Queries) ClearOrphanedFeeds(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, clearOrphanedFeeds)
+	return err
+}
+
+const completeFeedFetch = `-- name: CompleteFeedFetch :execrows
+UPDATE feeds
+SET last_fetched_at = NOW(),
+fetch_interval_seconds = $1,
+next_fetch_at = NOW() + $2::float8 * INTERVAL '1 second',
+lease_owner = NULL,
+lease_expires_at = NULL,
+updated_at = NOW()
+WHERE id = $3 AND lease_owner = $4
+`
+
+type CompleteFeedFetchParams struct {
+	FetchIntervalSeconds  int32
+	NextFetchDelaySeconds float64
+	ID                    uuid.UUID
+	LeaseOwner            sql.NullString
+}
+
+func (q *Queries) CompleteFeedFetch(ctx context.Context, arg CompleteFeedFetchParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, completeFeedFetch,
+		arg.FetchIntervalSeconds,
+		arg.NextFetchDelaySeconds,
+		arg.ID,
+		arg.LeaseOwner,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteFeed = `-- name: DeleteFeed :exec
+DELETE FROM feeds WHERE id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
+const deleteOrphanedFeeds = `-- name: DeleteOrphanedFeeds :execrows
+DELETE FROM feeds
+WHERE orphaned_at < $1
+AND NOT EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+`
+
+func (q *Queries) DeleteOrphanedFeeds(ctx context.Context, orphanedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOrphanedFeeds, orphanedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const findOrCreateFeed = `-- name: FindOrCreateFeed :one
+INSERT INTO feeds (id, created_at, updated_at, name, url, created_by)
 VALUES (
   $1,
   $2,
@@ -22,26 +172,28 @@ VALUES (
   $5,
   $6
   )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+ON CONFLICT (url) DO UPDATE
+SET orphaned_at = NULL
+RETURNING id, created_at, updated_at, name, url, created_by, last_fetched_at, orphaned_at, disabled_at, last_fetch_error, fetch_interval_seconds, next_fetch_at, lease_owner, lease_expires_at, encoding, last_parse_repair, fetch_full_content
 `
 
-type CreateFeedParams struct {
+type FindOrCreateFeedParams struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Name      string
 	Url       string
-	UserID    uuid.UUID
+	CreatedBy uuid.NullUUID
 }
 
-func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, createFeed,
+func (q *Queries) FindOrCreateFeed(ctx context.Context, arg FindOrCreateFeedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, findOrCreateFeed,
 		arg.ID,
 		arg.CreatedAt,
 		arg.UpdatedAt,
 		arg.Name,
 		arg.Url,
-		arg.UserID,
+		arg.CreatedBy,
 	)
 	var i Feed
 	err := row.Scan(
@@ -50,18 +202,31 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.UpdatedAt,
 		&i.Name,
 		&i.Url,
-		&i.UserID,
+		&i.CreatedBy,
 		&i.LastFetchedAt,
+		&i.OrphanedAt,
+		&i.DisabledAt,
+		&i.LastFetchError,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.Encoding,
+		&i.LastParseRepair,
+		&i.FetchFullContent,
 	)
 	return i, err
 }
 
-const getAllFeeds = `-- name: GetAllFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+const getFailingFeeds = `-- name: GetFailingFeeds :many
+SELECT id, created_at, updated_at, name, url, created_by, last_fetched_at, orphaned_at, disabled_at, last_fetch_error, fetch_interval_seconds, next_fetch_at, lease_owner, lease_expires_at, encoding, last_parse_repair, fetch_full_content FROM feeds
+WHERE last_fetch_error IS NOT NULL
+ORDER BY last_fetched_at DESC
+LIMIT $1
 `
 
-func (q *Queries) GetAllFeeds(ctx context.Context) ([]Feed, error) {
-	rows, err := q.db.QueryContext(ctx, getAllFeeds)
+func (q *Queries) GetFailingFeeds(ctx context.Context, limit int32) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFailingFeeds, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -75,8 +240,18 @@ func (q *Queries) GetAllFeeds(ctx context.Context) ([]Feed, error) {
 			&i.UpdatedAt,
 			&i.Name,
 			&i.Url,
-			&i.UserID,
+			&i.CreatedBy,
 			&i.LastFetchedAt,
+			&i.OrphanedAt,
+			&i.DisabledAt,
+			&i.LastFetchError,
+			&i.FetchIntervalSeconds,
+			&i.NextFetchAt,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Encoding,
+			&i.LastParseRepair,
+			&i.FetchFullContent,
 		); err != nil {
 			return nil, err
 		}
@@ -91,14 +266,72 @@ func (q *Queries) GetAllFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedsToFetch = `-- name: GetNextFeedsToFetch :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT $1
+const getFeed = `-- name: GetFeed :one
+SELECT id, created_at, updated_at, name, url, created_by, last_fetched_at, orphaned_at, disabled_at, last_fetch_error, fetch_interval_seconds, next_fetch_at, lease_owner, lease_expires_at, encoding, last_parse_repair, fetch_full_content FROM feeds WHERE id = $1
+`
+
+func (q *Queries) GetFeed(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeed, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.CreatedBy,
+		&i.LastFetchedAt,
+		&i.OrphanedAt,
+		&i.DisabledAt,
+		&i.LastFetchError,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.Encoding,
+		&i.LastParseRepair,
+		&i.FetchFullContent,
+	)
+	return i, err
+}
+
+const getFeedForUpdate = `-- name: GetFeedForUpdate :one
+SELECT id, created_at, updated_at, name, url, created_by, last_fetched_at, orphaned_at, disabled_at, last_fetch_error, fetch_interval_seconds, next_fetch_at, lease_owner, lease_expires_at, encoding, last_parse_repair, fetch_full_content FROM feeds WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetFeedForUpdate(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedForUpdate, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.CreatedBy,
+		&i.LastFetchedAt,
+		&i.OrphanedAt,
+		&i.DisabledAt,
+		&i.LastFetchError,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.Encoding,
+		&i.LastParseRepair,
+		&i.FetchFullContent,
+	)
+	return i, err
+}
+
+const getFeedsByUser = `-- name: GetFeedsByUser :many
+SELECT id, created_at, updated_at, name, url, created_by, last_fetched_at, orphaned_at, disabled_at, last_fetch_error, fetch_interval_seconds, next_fetch_at, lease_owner, lease_expires_at, encoding, last_parse_repair, fetch_full_content FROM feeds WHERE created_by = $1
+ORDER BY created_at ASC
 `
 
-func (q *Queries) GetNextFeedsToFetch(ctx context.Context, limit int32) ([]Feed, error) {
-	rows, err := q.db.QueryContext(ctx, getNextFeedsToFetch, limit)
+func (q *Queries) GetFeedsByUser(ctx context.Context, createdBy uuid.NullUUID) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeedsByUser, createdBy)
 	if err != nil {
 		return nil, err
 	}
@@ -112,8 +345,18 @@ func (q *Queries) GetNextFeedsToFetch(ctx context.Context, limit int32) ([]Feed,
 			&i.UpdatedAt,
 			&i.Name,
 			&i.Url,
-			&i.UserID,
+			&i.CreatedBy,
 			&i.LastFetchedAt,
+			&i.OrphanedAt,
+			&i.DisabledAt,
+			&i.LastFetchError,
+			&i.FetchIntervalSeconds,
+			&i.NextFetchAt,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.Encoding,
+			&i.LastParseRepair,
+			&i.FetchFullContent,
 		); err != nil {
 			return nil, err
 		}
@@ -128,31 +371,145 @@ func (q *Queries) GetNextFeedsToFetch(ctx context.Context, limit int32) ([]Feed,
 	return items, nil
 }
 
-const markFeedFetched = `-- name: MarkFeedFetched :many
-UPDATE feeds
-SET last_fetched_at = NOW(),
-updated_at = NOW()
-WHERE id = $1
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+const getScraperStatus = `-- name: GetScraperStatus :one
+SELECT
+  COUNT(*) AS total_feeds,
+  COUNT(*) FILTER (WHERE disabled_at IS NOT NULL) AS disabled_feeds,
+  COUNT(*) FILTER (WHERE last_fetched_at IS NULL) AS never_fetched_feeds,
+  COUNT(*) FILTER (WHERE last_fetch_error IS NOT NULL) AS failing_feeds,
+  COUNT(*) FILTER (WHERE lease_expires_at > NOW()) AS leased_feeds
+FROM feeds
+`
+
+type GetScraperStatusRow struct {
+	TotalFeeds        int64
+	DisabledFeeds     int64
+	NeverFetchedFeeds int64
+	FailingFeeds      int64
+	LeasedFeeds       int64
+}
+
+func (q *Queries) GetScraperStatus(ctx context.Context) (GetScraperStatusRow, error) {
+	row := q.db.QueryRowContext(ctx, getScraperStatus)
+	var i GetScraperStatusRow
+	err := row.Scan(
+		&i.TotalFeeds,
+		&i.DisabledFeeds,
+		&i.NeverFetchedFeeds,
+		&i.FailingFeeds,
+		&i.LeasedFeeds,
+	)
+	return i, err
+}
+
+const listFeedDirectory = `-- name: ListFeedDirectory :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url,
+(
+  SELECT COUNT(*) FROM feed_follows WHERE feed_follows.feed_id = feeds.id
+) AS follower_count,
+(
+  SELECT posts.published_at FROM posts
+  WHERE posts.feed_id = feeds.id
+  ORDER BY posts.published_at DESC NULLS LAST
+  LIMIT 1
+) AS last_post_at,
+EXISTS (
+  SELECT 1 FROM feed_follows
+  WHERE feed_follows.feed_id = feeds.id
+  AND feed_follows.user_id = $1
+) AS followed
+FROM (
+  SELECT sorted.* FROM (
+    SELECT feeds.id,
+    CASE WHEN $2::text = 'name' THEN lower(feeds.name) END AS name_key,
+    CASE WHEN $2::text = 'created' THEN feeds.created_at END AS created_key,
+    CASE WHEN $2::text = 'followers' THEN (
+      SELECT COUNT(*) FROM feed_follows WHERE feed_follows.feed_id = feeds.id
+    ) END AS followers_key,
+    CASE WHEN $2::text = 'last_post' THEN (
+      SELECT posts.published_at FROM posts
+      WHERE posts.feed_id = feeds.id
+      ORDER BY posts.published_at DESC NULLS LAST
+      LIMIT 1
+    ) END AS last_post_key
+    FROM feeds
+    WHERE feeds.disabled_at IS NULL
+    AND (
+      $3::text IS NULL
+      OR feeds.name ILIKE '%' || $3 || '%'
+      OR feeds.url ILIKE '%' || $3 || '%'
+    )
+  ) AS sorted
+  ORDER BY
+    CASE WHEN NOT $4::bool THEN sorted.name_key END ASC,
+    CASE WHEN $4::bool THEN sorted.name_key END DESC,
+    CASE WHEN NOT $4::bool THEN sorted.created_key END ASC,
+    CASE WHEN $4::bool THEN sorted.created_key END DESC,
+    CASE WHEN NOT $4::bool THEN sorted.followers_key END ASC,
+    CASE WHEN $4::bool THEN sorted.followers_key END DESC,
+    CASE WHEN NOT $4::bool THEN sorted.last_post_key END ASC NULLS LAST,
+    CASE WHEN $4::bool THEN sorted.last_post_key END DESC NULLS LAST,
+    sorted.id
+  LIMIT $5 OFFSET $6
+) AS page
+JOIN feeds ON feeds.id = page.id
+ORDER BY
+  CASE WHEN NOT $4::bool THEN page.name_key END ASC,
+  CASE WHEN $4::bool THEN page.name_key END DESC,
+  CASE WHEN NOT $4::bool THEN page.created_key END ASC,
+  CASE WHEN $4::bool THEN page.created_key END DESC,
+  CASE WHEN NOT $4::bool THEN page.followers_key END ASC,
+  CASE WHEN $4::bool THEN page.followers_key END DESC,
+  CASE WHEN NOT $4::bool THEN page.last_post_key END ASC NULLS LAST,
+  CASE WHEN $4::bool THEN page.last_post_key END DESC NULLS LAST,
+  page.id
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) ([]Feed, error) {
-	rows, err := q.db.QueryContext(ctx, markFeedFetched, id)
+type ListFeedDirectoryParams struct {
+	UserID     uuid.NullUUID
+	Sort       string
+	Search     sql.NullString
+	Descending bool
+	RowLimit   int32
+	RowOffset  int32
+}
+
+type ListFeedDirectoryRow struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Name          string
+	Url           string
+	FollowerCount int64
+	LastPostAt    sql.NullTime
+	Followed      bool
+}
+
+func (q *Queries) ListFeedDirectory(ctx context.Context, arg ListFeedDirectoryParams) ([]ListFeedDirectoryRow, error) {
+	rows, err := q.db.QueryContext(ctx, listFeedDirectory,
+		arg.UserID,
+		arg.Sort,
+		arg.Search,
+		arg.Descending,
+		arg.RowLimit,
+		arg.RowOffset,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Feed
+	var items []ListFeedDirectoryRow
 	for rows.Next() {
-		var i Feed
+		var i ListFeedDirectoryRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Name,
 			&i.Url,
-			&i.UserID,
-			&i.LastFetchedAt,
+			&i.FollowerCount,
+			&i.LastPostAt,
+			&i.Followed,
 		); err != nil {
 			return nil, err
 		}
@@ -166,3 +523,297 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) ([]Feed, er
 	}
 	return items, nil
 }
+
+const lockLeasedFeed = `-- name: LockLeasedFeed :one
+SELECT id FROM feeds
+WHERE id = $1 AND lease_owner = $2
+FOR SHARE
+`
+
+type LockLeasedFeedParams struct {
+	ID         uuid.UUID
+	LeaseOwner sql.NullString
+}
+
+func (q *Queries) LockLeasedFeed(ctx context.Context, arg LockLeasedFeedParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, lockLeasedFeed, arg.ID, arg.LeaseOwner)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const markOrphanedFeeds = `-- name: MarkOrphanedFeeds :exec
+UPDATE feeds
+SET orphaned_at = $1
+WHERE orphaned_at IS NULL
+AND NOT EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+`
+
+func (q *Queries) MarkOrphanedFeeds(ctx context.Context, orphanedAt sql.NullTime) error {
+	_, err := q.db.ExecContext(ctx, markOrphanedFeeds, orphanedAt)
+	return err
+}
+
+const moveFeedFollows = `-- name: MoveFeedFollows :exec
+INSERT INTO feed_follows (id, feed_id, user_id, created_at, updated_at, poll_interval_seconds)
+SELECT gen_random_uuid(), $1::uuid, user_id, created_at, NOW(), poll_interval_seconds
+FROM feed_follows
+WHERE feed_id = $2::uuid
+ON CONFLICT (feed_id, user_id) DO UPDATE
+SET poll_interval_seconds = LEAST(feed_follows.poll_interval_seconds, EXCLUDED.poll_interval_seconds),
+updated_at = EXCLUDED.updated_at
+WHERE LEAST(feed_follows.poll_interval_seconds, EXCLUDED.poll_interval_seconds)
+IS DISTINCT FROM feed_follows.poll_interval_seconds
+`
+
+type MoveFeedFollowsParams struct {
+	IntoFeedID uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+func (q *Queries) MoveFeedFollows(ctx context.Context, arg MoveFeedFollowsParams) error {
+	_, err := q.db.ExecContext(ctx, moveFeedFollows, arg.IntoFeedID, arg.FromFeedID)
+	return err
+}
+
+const releaseFeedLease = `-- name: ReleaseFeedLease :exec
+UPDATE feeds
+SET lease_owner = NULL,
+lease_expires_at = NULL
+WHERE id = $1 AND lease_owner = $2
+`
+
+type ReleaseFeedLeaseParams struct {
+	ID         uuid.UUID
+	LeaseOwner sql.NullString
+}
+
+func (q *Queries) ReleaseFeedLease(ctx context.Context, arg ReleaseFeedLeaseParams) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedLease, arg.ID, arg.LeaseOwner)
+	return err
+}
+
+const resetFeedFetch = `-- name: ResetFeedFetch :one
+UPDATE feeds
+SET last_fetched_at = NULL,
+next_fetch_at = NULL,
+fetch_interval_seconds = DEFAULT,
+last_fetch_error = NULL,
+encoding = NULL,
+last_parse_repair = NULL,
+lease_owner = NULL,
+lease_expires_at = NULL,
+updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, url, created_by, last_fetched_at, orphaned_at, disabled_at, last_fetch_error, fetch_interval_seconds, next_fetch_at, lease_owner, lease_expires_at, encoding, last_parse_repair, fetch_full_content
+`
+
+func (q *Queries) ResetFeedFetch(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, resetFeedFetch, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.CreatedBy,
+		&i.LastFetchedAt,
+		&i.OrphanedAt,
+		&i.DisabledAt,
+		&i.LastFetchError,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.Encoding,
+		&i.LastParseRepair,
+		&i.FetchFullContent,
+	)
+	return i, err
+}
+
+const setFeedDisabledAt = `-- name: SetFeedDisabledAt :one
+UPDATE feeds
+SET disabled_at = $2,
+updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, url, created_by, last_fetched_at, orphaned_at, disabled_at, last_fetch_error, fetch_interval_seconds, next_fetch_at, lease_owner, lease_expires_at, encoding, last_parse_repair, fetch_full_content
+`
+
+type SetFeedDisabledAtParams struct {
+	ID         uuid.UUID
+	DisabledAt sql.NullTime
+}
+
+func (q *Queries) SetFeedDisabledAt(ctx context.Context, arg SetFeedDisabledAtParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedDisabledAt, arg.ID, arg.DisabledAt)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.CreatedBy,
+		&i.LastFetchedAt,
+		&i.OrphanedAt,
+		&i.DisabledAt,
+		&i.LastFetchError,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.Encoding,
+		&i.LastParseRepair,
+		&i.FetchFullContent,
+	)
+	return i, err
+}
+
+const setFeedEncoding = `-- name: SetFeedEncoding :exec
+UPDATE feeds
+SET encoding = $2
+WHERE id = $1
+`
+
+type SetFeedEncodingParams struct {
+	ID       uuid.UUID
+	Encoding sql.NullString
+}
+
+func (q *Queries) SetFeedEncoding(ctx context.Context, arg SetFeedEncodingParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedEncoding, arg.ID, arg.Encoding)
+	return err
+}
+
+const setFeedFetchError = `-- name: SetFeedFetchError :exec
+UPDATE feeds
+SET last_fetch_error = $2
+WHERE id = $1
+`
+
+type SetFeedFetchErrorParams struct {
+	ID             uuid.UUID
+	LastFetchError sql.NullString
+}
+
+func (q *Queries) SetFeedFetchError(ctx context.Context, arg SetFeedFetchErrorParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedFetchError, arg.ID, arg.LastFetchError)
+	return err
+}
+
+const setFeedFetchFullContent = `-- name: SetFeedFetchFullContent :one
+UPDATE feeds
+SET fetch_full_content = $2,
+updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, url, created_by, last_fetched_at, orphaned_at, disabled_at, last_fetch_error, fetch_interval_seconds, next_fetch_at, lease_owner, lease_expires_at, encoding, last_parse_repair, fetch_full_content
+`
+
+type SetFeedFetchFullContentParams struct {
+	ID               uuid.UUID
+	FetchFullContent bool
+}
+
+func (q *Queries) SetFeedFetchFullContent(ctx context.Context, arg SetFeedFetchFullContentParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, setFeedFetchFullContent, arg.ID, arg.FetchFullContent)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.CreatedBy,
+		&i.LastFetchedAt,
+		&i.OrphanedAt,
+		&i.DisabledAt,
+		&i.LastFetchError,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.Encoding,
+		&i.LastParseRepair,
+		&i.FetchFullContent,
+	)
+	return i, err
+}
+
+const setFeedParseRepair = `-- name: SetFeedParseRepair :exec
+UPDATE feeds
+SET last_parse_repair = $2
+WHERE id = $1
+`
+
+type SetFeedParseRepairParams struct {
+	ID              uuid.UUID
+	LastParseRepair sql.NullString
+}
+
+func (q *Queries) SetFeedParseRepair(ctx context.Context, arg SetFeedParseRepairParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedParseRepair, arg.ID, arg.LastParseRepair)
+	return err
+}
+
+const updateFeed = `-- name: UpdateFeed :one
+UPDATE feeds
+SET name = $2,
+url = $3,
+updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, url, created_by, last_fetched_at, orphaned_at, disabled_at, last_fetch_error, fetch_interval_seconds, next_fetch_at, lease_owner, lease_expires_at, encoding, last_parse_repair, fetch_full_content
+`
+
+type UpdateFeedParams struct {
+	ID   uuid.UUID
+	Name string
+	Url  string
+}
+
+func (q *Queries) UpdateFeed(ctx context.Context, arg UpdateFeedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, updateFeed, arg.ID, arg.Name, arg.Url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.CreatedBy,
+		&i.LastFetchedAt,
+		&i.OrphanedAt,
+		&i.DisabledAt,
+		&i.LastFetchError,
+		&i.FetchIntervalSeconds,
+		&i.NextFetchAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.Encoding,
+		&i.LastParseRepair,
+		&i.FetchFullContent,
+	)
+	return i, err
+}
+
+const updateFeedUrl = `-- name: UpdateFeedUrl :execrows
+UPDATE feeds
+SET url = $2,
+updated_at = NOW()
+WHERE id = $1 AND lease_owner = $3
+`
+
+type UpdateFeedUrlParams struct {
+	ID         uuid.UUID
+	Url        string
+	LeaseOwner sql.NullString
+}
+
+func (q *Queries) UpdateFeedUrl(ctx context.Context, arg UpdateFeedUrlParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateFeedUrl, arg.ID, arg.Url, arg.LeaseOwner)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -6,44 +6,125 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type AuditLog struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	ActorID    uuid.NullUUID
+	Action     string
+	TargetType string
+	TargetID   uuid.NullUUID
+	Details    json.RawMessage
+	RequestID  string
+	Ip         string
+	Before     json.RawMessage
+	After      json.RawMessage
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Name                 string
+	Url                  string
+	CreatedBy            uuid.NullUUID
+	LastFetchedAt        sql.NullTime
+	OrphanedAt           sql.NullTime
+	DisabledAt           sql.NullTime
+	LastFetchError       sql.NullString
+	FetchIntervalSeconds int32
+	NextFetchAt          sql.NullTime
+	LeaseOwner           sql.NullString
+	LeaseExpiresAt       sql.NullTime
+	Encoding             sql.NullString
+	LastParseRepair      sql.NullString
+	FetchFullContent     bool
 }
 
 type FeedFollow struct {
-	ID        uuid.UUID
-	FeedID    uuid.UUID
-	UserID    uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID                  uuid.UUID
+	FeedID              uuid.UUID
+	UserID              uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	PollIntervalSeconds sql.NullInt32
+}
+
+type PlaybackPosition struct {
+	UserID          uuid.UUID
+	PostID          uuid.UUID
+	PositionSeconds int32
+	Completed       bool
+	UpdatedAt       time.Time
+}
+
+type PodcastEpisode struct {
+	PostID          uuid.UUID
+	DurationSeconds int32
+	Episode         int32
+	Season          int32
+	Explicit        bool
+	ArtworkUrl      string
 }
 
 type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description string
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	ID                       uuid.UUID
+	CreatedAt                time.Time
+	UpdatedAt                time.Time
+	Title                    string
+	Url                      string
+	Description              string
+	PublishedAt              sql.NullTime
+	FeedID                   uuid.UUID
+	Guid                     string
+	Author                   string
+	Content                  string
+	ThumbnailUrl             string
+	DedupKey                 string
+	RawDescription           string
+	RawContent               string
+	Excerpt                  string
+	FullContent              string
+	ExtractionStatus         string
+	ExtractionError          string
+	ExtractionAttempts       int32
+	ExtractionLeaseExpiresAt sql.NullTime
+	ExtractedAt              sql.NullTime
+	HtmlSanitized            bool
 }
 
-type User struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
+type PostCategory struct {
+	PostID uuid.UUID
+	Name   string
+}
+
+type PostEnclosure struct {
+	ID     uuid.UUID
+	PostID uuid.UUID
+	Url    string
+	Type   string
+	Length int64
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
 	UpdatedAt time.Time
-	Name      string
-	Apikey    string
+}
+
+type User struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Name        string
+	Apikey      string
+	Preferences json.RawMessage
+	IsAdmin     bool
+	DisabledAt  sql.NullTime
 }
@@ -7,49 +7,180 @@ package database
 
 import (
 	"context"
-	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES (
-  $1,
-  $2,
-  $3,
-  $4,
-  $5,
-  $6,
-  $7,
-  $8
-  )
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
-`
-
-type CreatePostParams struct {
+const adoptLegacyPostKeys = `-- name: AdoptLegacyPostKeys :exec
+UPDATE posts
+SET dedup_key = item.dedup_key
+FROM unnest($1::text[], $2::text[]) AS item(legacy_key, dedup_key)
+WHERE posts.feed_id = $3::uuid
+AND posts.guid = ''
+AND posts.dedup_key = item.legacy_key
+AND NOT EXISTS (
+  SELECT 1 FROM posts AS existing
+  WHERE existing.feed_id = $3::uuid
+  AND existing.dedup_key = item.dedup_key
+)
+`
+
+type AdoptLegacyPostKeysParams struct {
+	LegacyKeys []string
+	DedupKeys  []string
+	FeedID     uuid.UUID
+}
+
+func (q *Queries) AdoptLegacyPostKeys(ctx context.Context, arg AdoptLegacyPostKeysParams) error {
+	_, err := q.db.ExecContext(ctx, adoptLegacyPostKeys, pq.Array(arg.LegacyKeys), pq.Array(arg.DedupKeys), arg.FeedID)
+	return err
+}
+
+const claimPendingExtractions = `-- name: ClaimPendingExtractions :many
+UPDATE posts
+SET extraction_lease_expires_at = NOW() + $1::float8 * INTERVAL '1 second',
+extraction_attempts = extraction_attempts + 1
+WHERE id IN (
+  SELECT id FROM posts
+  WHERE extraction_status = 'pending'
+  AND (extraction_lease_expires_at IS NULL OR extraction_lease_expires_at <= NOW())
+  ORDER BY created_at ASC
+  LIMIT $2
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, guid, author, content, thumbnail_url, dedup_key, raw_description, raw_content, excerpt, full_content, extraction_status, extraction_error, extraction_attempts, extraction_lease_expires_at, extracted_at, html_sanitized
+`
+
+type ClaimPendingExtractionsParams struct {
+	LeaseSeconds float64
+	MaxPosts     int32
+}
+
+func (q *Queries) ClaimPendingExtractions(ctx context.Context, arg ClaimPendingExtractionsParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, claimPendingExtractions, arg.LeaseSeconds, arg.MaxPosts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.Author,
+			&i.Content,
+			&i.ThumbnailUrl,
+			&i.DedupKey,
+			&i.RawDescription,
+			&i.RawContent,
+			&i.Excerpt,
+			&i.FullContent,
+			&i.ExtractionStatus,
+			&i.ExtractionError,
+			&i.ExtractionAttempts,
+			&i.ExtractionLeaseExpiresAt,
+			&i.ExtractedAt,
+			&i.HtmlSanitized,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const completeExtraction = `-- name: CompleteExtraction :exec
+UPDATE posts
+SET full_content = $2,
+extraction_status = 'done',
+extraction_error = '',
+extraction_lease_expires_at = NULL,
+extracted_at = NOW()
+WHERE id = $1
+`
+
+type CompleteExtractionParams struct {
 	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	Description string
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
+	FullContent string
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.CreatedAt,
-		arg.UpdatedAt,
-		arg.Title,
-		arg.Url,
-		arg.Description,
-		arg.PublishedAt,
-		arg.FeedID,
+func (q *Queries) CompleteExtraction(ctx context.Context, arg CompleteExtractionParams) error {
+	_, err := q.db.ExecContext(ctx, completeExtraction, arg.ID, arg.FullContent)
+	return err
+}
+
+const createPostCategories = `-- name: CreatePostCategories :exec
+INSERT INTO post_categories (post_id, name)
+SELECT category.post_id, category.name
+FROM unnest($1::uuid[], $2::text[]) AS category(post_id, name)
+ON CONFLICT DO NOTHING
+`
+
+type CreatePostCategoriesParams struct {
+	PostIds []uuid.UUID
+	Names   []string
+}
+
+func (q *Queries) CreatePostCategories(ctx context.Context, arg CreatePostCategoriesParams) error {
+	_, err := q.db.ExecContext(ctx, createPostCategories, pq.Array(arg.PostIds), pq.Array(arg.Names))
+	return err
+}
+
+const createPostEnclosures = `-- name: CreatePostEnclosures :exec
+INSERT INTO post_enclosures (id, post_id, url, type, length)
+SELECT enclosure.id, enclosure.post_id, enclosure.url, enclosure.type, enclosure.length
+FROM unnest(
+  $1::uuid[],
+  $2::uuid[],
+  $3::text[],
+  $4::text[],
+  $5::bigint[]
+) AS enclosure(id, post_id, url, type, length)
+ON CONFLICT (post_id, url) DO NOTHING
+`
+
+type CreatePostEnclosuresParams struct {
+	Ids     []uuid.UUID
+	PostIds []uuid.UUID
+	Urls    []string
+	Types   []string
+	Lengths []int64
+}
+
+func (q *Queries) CreatePostEnclosures(ctx context.Context, arg CreatePostEnclosuresParams) error {
+	_, err := q.db.ExecContext(ctx, createPostEnclosures,
+		pq.Array(arg.Ids),
+		pq.Array(arg.PostIds),
+		pq.Array(arg.Urls),
+		pq.Array(arg.Types),
+		pq.Array(arg.Lengths),
 	)
+	return err
+}
+
+const deletePost = `-- name: DeletePost :one
+DELETE FROM posts WHERE id = $1
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, guid, author, content, thumbnail_url, dedup_key, raw_description, raw_content, excerpt, full_content, extraction_status, extraction_error, extraction_attempts, extraction_lease_expires_at, extracted_at, html_sanitized
+`
+
+func (q *Queries) DeletePost(ctx context.Context, id uuid.UUID) (Post, error) {
+	row := q.db.QueryRowContext(ctx, deletePost, id)
 	var i Post
 	err := row.Scan(
 		&i.ID,
@@ -60,56 +191,452 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Guid,
+		&i.Author,
+		&i.Content,
+		&i.ThumbnailUrl,
+		&i.DedupKey,
+		&i.RawDescription,
+		&i.RawContent,
+		&i.Excerpt,
+		&i.FullContent,
+		&i.ExtractionStatus,
+		&i.ExtractionError,
+		&i.ExtractionAttempts,
+		&i.ExtractionLeaseExpiresAt,
+		&i.ExtractedAt,
+		&i.HtmlSanitized,
 	)
 	return i, err
 }
 
-const getPostByUser = `-- name: GetPostByUser :one
-SELECT posts.id, posts.created_at, posts.updated_at, title, url, description, published_at, posts.feed_id, feed_follows.id, feed_follows.feed_id, user_id, feed_follows.created_at, feed_follows.updated_at FROM posts
+const deletePostCategories = `-- name: DeletePostCategories :exec
+DELETE FROM post_categories
+WHERE post_id = ANY($1::uuid[])
+`
+
+func (q *Queries) DeletePostCategories(ctx context.Context, postIds []uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deletePostCategories, pq.Array(postIds))
+	return err
+}
+
+const deletePostEnclosures = `-- name: DeletePostEnclosures :exec
+DELETE FROM post_enclosures
+WHERE post_id = ANY($1::uuid[])
+`
+
+func (q *Queries) DeletePostEnclosures(ctx context.Context, postIds []uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deletePostEnclosures, pq.Array(postIds))
+	return err
+}
+
+const failExtraction = `-- name: FailExtraction :exec
+UPDATE posts
+SET extraction_error = $1,
+extraction_status = CASE
+  WHEN extraction_attempts >= $2::integer THEN 'failed'
+  ELSE 'pending'
+END,
+extraction_lease_expires_at = NOW() + $3::float8 * INTERVAL '1 second'
+WHERE id = $4
+`
+
+type FailExtractionParams struct {
+	ExtractionError   string
+	MaxAttempts       int32
+	RetryDelaySeconds float64
+	ID                uuid.UUID
+}
+
+func (q *Queries) FailExtraction(ctx context.Context, arg FailExtractionParams) error {
+	_, err := q.db.ExecContext(ctx, failExtraction,
+		arg.ExtractionError,
+		arg.MaxAttempts,
+		arg.RetryDelaySeconds,
+		arg.ID,
+	)
+	return err
+}
+
+const getPostCategories = `-- name: GetPostCategories :many
+SELECT post_id, name FROM post_categories
+WHERE post_id = ANY($1::uuid[])
+ORDER BY post_id, name
+`
+
+func (q *Queries) GetPostCategories(ctx context.Context, postIds []uuid.UUID) ([]PostCategory, error) {
+	rows, err := q.db.QueryContext(ctx, getPostCategories, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PostCategory
+	for rows.Next() {
+		var i PostCategory
+		if err := rows.Scan(&i.PostID, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostEnclosures = `-- name: GetPostEnclosures :many
+SELECT id, post_id, url, type, length FROM post_enclosures
+WHERE post_id = ANY($1::uuid[])
+ORDER BY post_id, url
+`
+
+func (q *Queries) GetPostEnclosures(ctx context.Context, postIds []uuid.UUID) ([]PostEnclosure, error) {
+	rows, err := q.db.QueryContext(ctx, getPostEnclosures, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PostEnclosure
+	for rows.Next() {
+		var i PostEnclosure
+		if err := rows.Scan(
+			&i.ID,
+			&i.PostID,
+			&i.Url,
+			&i.Type,
+			&i.Length,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostsForUser = `-- name: GetPostsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid, posts.author, posts.content, posts.thumbnail_url, posts.dedup_key, posts.raw_description, posts.raw_content, posts.excerpt, posts.full_content, posts.extraction_status, posts.extraction_error, posts.extraction_attempts, posts.extraction_lease_expires_at, posts.extracted_at, posts.html_sanitized FROM posts
 JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
 WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
+ORDER BY posts.published_at DESC NULLS LAST, posts.created_at DESC
 LIMIT $2
 `
 
-type GetPostByUserParams struct {
+type GetPostsForUserParams struct {
 	UserID uuid.UUID
 	Limit  int32
 }
 
-type GetPostByUserRow struct {
+func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.Author,
+			&i.Content,
+			&i.ThumbnailUrl,
+			&i.DedupKey,
+			&i.RawDescription,
+			&i.RawContent,
+			&i.Excerpt,
+			&i.FullContent,
+			&i.ExtractionStatus,
+			&i.ExtractionError,
+			&i.ExtractionAttempts,
+			&i.ExtractionLeaseExpiresAt,
+			&i.ExtractedAt,
+			&i.HtmlSanitized,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUnsanitizedPosts = `-- name: GetUnsanitizedPosts :many
+SELECT posts.id, posts.url, posts.raw_description, posts.raw_content, feeds.url AS feed_url
+FROM posts
+JOIN feeds ON feeds.id = posts.feed_id
+WHERE NOT posts.html_sanitized
+LIMIT $1
+`
+
+type GetUnsanitizedPostsRow struct {
+	ID             uuid.UUID
+	Url            string
+	RawDescription string
+	RawContent     string
+	FeedUrl        string
+}
+
+func (q *Queries) GetUnsanitizedPosts(ctx context.Context, limit int32) ([]GetUnsanitizedPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUnsanitizedPosts, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetUnsanitizedPostsRow
+	for rows.Next() {
+		var i GetUnsanitizedPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			&i.RawDescription,
+			&i.RawContent,
+			&i.FeedUrl,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const movePosts = `-- name: MovePosts :exec
+UPDATE posts
+SET feed_id = $1::uuid,
+updated_at = NOW()
+WHERE feed_id = $2::uuid
+AND NOT EXISTS (
+  SELECT 1 FROM posts AS existing
+  WHERE existing.feed_id = $1::uuid
+  AND existing.dedup_key = posts.dedup_key
+)
+`
+
+type MovePostsParams struct {
+	IntoFeedID uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+func (q *Queries) MovePosts(ctx context.Context, arg MovePostsParams) error {
+	_, err := q.db.ExecContext(ctx, movePosts, arg.IntoFeedID, arg.FromFeedID)
+	return err
+}
+
+const queuePostsForExtraction = `-- name: QueuePostsForExtraction :exec
+UPDATE posts
+SET extraction_status = 'pending'
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) QueuePostsForExtraction(ctx context.Context, ids []uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, queuePostsForExtraction, pq.Array(ids))
+	return err
+}
+
+const setPostSanitizedHTML = `-- name: SetPostSanitizedHTML :exec
+UPDATE posts
+SET description = $2,
+content = $3,
+excerpt = $4,
+html_sanitized = TRUE
+WHERE id = $1
+`
+
+type SetPostSanitizedHTMLParams struct {
 	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
 	Description string
-	PublishedAt sql.NullTime
-	FeedID      uuid.UUID
-	ID_2        uuid.UUID
-	FeedID_2    uuid.UUID
-	UserID      uuid.UUID
-	CreatedAt_2 time.Time
-	UpdatedAt_2 time.Time
-}
-
-func (q *Queries) GetPostByUser(ctx context.Context, arg GetPostByUserParams) (GetPostByUserRow, error) {
-	row := q.db.QueryRowContext(ctx, getPostByUser, arg.UserID, arg.Limit)
-	var i GetPostByUserRow
-	err := row.Scan(
-		&i.ID,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.Title,
-		&i.Url,
-		&i.Description,
-		&i.PublishedAt,
-		&i.FeedID,
-		&i.ID_2,
-		&i.FeedID_2,
-		&i.UserID,
-		&i.CreatedAt_2,
-		&i.UpdatedAt_2,
+	Content     string
+	Excerpt     string
+}
+
+func (q *Queries) SetPostSanitizedHTML(ctx context.Context, arg SetPostSanitizedHTMLParams) error {
+	_, err := q.db.ExecContext(ctx, setPostSanitizedHTML,
+		arg.ID,
+		arg.Description,
+		arg.Content,
+		arg.Excerpt,
 	)
-	return i, err
+	return err
+}
+
+const upsertPosts = `-- name: UpsertPosts :many
+INSERT INTO posts (
+  id,
+  created_at,
+  updated_at,
+  title,
+  url,
+  description,
+  published_at,
+  feed_id,
+  guid,
+  author,
+  content,
+  thumbnail_url,
+  dedup_key,
+  raw_description,
+  raw_content,
+  excerpt
+)
+SELECT
+  item.id,
+  $1::timestamp,
+  $1::timestamp,
+  item.title,
+  item.url,
+  item.description,
+  NULLIF(item.published_at, '')::timestamp,
+  $2::uuid,
+  item.guid,
+  item.author,
+  item.content,
+  item.thumbnail_url,
+  item.dedup_key,
+  item.raw_description,
+  item.raw_content,
+  item.excerpt
+FROM unnest(
+  $3::uuid[],
+  $4::text[],
+  $5::text[],
+  $6::text[],
+  $7::text[],
+  $8::text[],
+  $9::text[],
+  $10::text[],
+  $11::text[],
+  $12::text[],
+  $13::text[],
+  $14::text[],
+  $15::text[]
+) AS item(
+  id,
+  title,
+  url,
+  description,
+  published_at,
+  guid,
+  author,
+  content,
+  thumbnail_url,
+  dedup_key,
+  raw_description,
+  raw_content,
+  excerpt
+)
+ON CONFLICT (feed_id, dedup_key) DO UPDATE
+SET title = EXCLUDED.title,
+url = EXCLUDED.url,
+description = EXCLUDED.description,
+published_at = COALESCE(EXCLUDED.published_at, posts.published_at),
+guid = EXCLUDED.guid,
+author = EXCLUDED.author,
+content = EXCLUDED.content,
+thumbnail_url = EXCLUDED.thumbnail_url,
+raw_description = EXCLUDED.raw_description,
+raw_content = EXCLUDED.raw_content,
+excerpt = EXCLUDED.excerpt,
+updated_at = EXCLUDED.updated_at
+WHERE (posts.title, posts.url, posts.raw_description, posts.author, posts.raw_content, posts.thumbnail_url)
+IS DISTINCT FROM
+(EXCLUDED.title, EXCLUDED.url, EXCLUDED.raw_description, EXCLUDED.author, EXCLUDED.raw_content, EXCLUDED.thumbnail_url)
+OR (posts.description, posts.content) IS DISTINCT FROM (EXCLUDED.description, EXCLUDED.content)
+OR (EXCLUDED.published_at IS NOT NULL AND EXCLUDED.published_at IS DISTINCT FROM posts.published_at)
+RETURNING id, title, dedup_key, (xmax = 0) AS inserted
+`
+
+type UpsertPostsParams struct {
+	Now             time.Time
+	FeedID          uuid.UUID
+	Ids             []uuid.UUID
+	Titles          []string
+	Urls            []string
+	Descriptions    []string
+	PublishedAts    []string
+	Guids           []string
+	Authors         []string
+	Contents        []string
+	ThumbnailUrls   []string
+	DedupKeys       []string
+	RawDescriptions []string
+	RawContents     []string
+	Excerpts        []string
+}
+
+type UpsertPostsRow struct {
+	ID       uuid.UUID
+	Title    string
+	DedupKey string
+	Inserted bool
+}
+
+func (q *Queries) UpsertPosts(ctx context.Context, arg UpsertPostsParams) ([]UpsertPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, upsertPosts,
+		arg.Now,
+		arg.FeedID,
+		pq.Array(arg.Ids),
+		pq.Array(arg.Titles),
+		pq.Array(arg.Urls),
+		pq.Array(arg.Descriptions),
+		pq.Array(arg.PublishedAts),
+		pq.Array(arg.Guids),
+		pq.Array(arg.Authors),
+		pq.Array(arg.Contents),
+		pq.Array(arg.ThumbnailUrls),
+		pq.Array(arg.DedupKeys),
+		pq.Array(arg.RawDescriptions),
+		pq.Array(arg.RawContents),
+		pq.Array(arg.Excerpts),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UpsertPostsRow
+	for rows.Next() {
+		var i UpsertPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.DedupKey,
+			&i.Inserted,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
@@ -7,9 +7,12 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createUser = `-- name: CreateUser :one
@@ -21,7 +24,7 @@ VALUES (
   $4,
   encode(sha256(random()::text::bytea), 'hex')
   )
-RETURNING id, created_at, updated_at, name, apikey
+RETURNING id, created_at, updated_at, name, apikey, preferences, is_admin, disabled_at
 `
 
 type CreateUserParams struct {
@@ -45,12 +48,24 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.Name,
 		&i.Apikey,
+		&i.Preferences,
+		&i.IsAdmin,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUser, id)
+	return err
+}
+
 const getUser = `-- name: GetUser :one
-SELECT id, created_at, updated_at, name, apikey FROM users WHERE apikey = $1
+SELECT id, created_at, updated_at, name, apikey, preferences, is_admin, disabled_at FROM users WHERE apikey = $1
 `
 
 func (q *Queries) GetUser(ctx context.Context, apikey string) (User, error) {
@@ -62,6 +77,157 @@ func (q *Queries) GetUser(ctx context.Context, apikey string) (User, error) {
 		&i.UpdatedAt,
 		&i.Name,
 		&i.Apikey,
+		&i.Preferences,
+		&i.IsAdmin,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, created_at, updated_at, name, is_admin, disabled_at FROM users
+ORDER BY created_at ASC
+LIMIT $1 OFFSET $2
+`
+
+type ListUsersParams struct {
+	Limit  int32
+	Offset int32
+}
+
+type ListUsersRow struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Name       string
+	IsAdmin    bool
+	DisabledAt sql.NullTime
+}
+
+func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]ListUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUsersRow
+	for rows.Next() {
+		var i ListUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.IsAdmin,
+			&i.DisabledAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const promoteUsersToAdmin = `-- name: PromoteUsersToAdmin :many
+UPDATE users
+SET is_admin = TRUE,
+updated_at = NOW()
+WHERE id = ANY($1::uuid[]) AND NOT is_admin
+RETURNING id
+`
+
+func (q *Queries) PromoteUsersToAdmin(ctx context.Context, ids []uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, promoteUsersToAdmin, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserDisabledAt = `-- name: SetUserDisabledAt :one
+UPDATE users
+SET disabled_at = $2,
+updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, is_admin, disabled_at
+`
+
+type SetUserDisabledAtParams struct {
+	ID         uuid.UUID
+	DisabledAt sql.NullTime
+}
+
+type SetUserDisabledAtRow struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Name       string
+	IsAdmin    bool
+	DisabledAt sql.NullTime
+}
+
+func (q *Queries) SetUserDisabledAt(ctx context.Context, arg SetUserDisabledAtParams) (SetUserDisabledAtRow, error) {
+	row := q.db.QueryRowContext(ctx, setUserDisabledAt, arg.ID, arg.DisabledAt)
+	var i SetUserDisabledAtRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.IsAdmin,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET name = $2,
+preferences = $3,
+updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, apikey, preferences, is_admin, disabled_at
+`
+
+type UpdateUserParams struct {
+	ID          uuid.UUID
+	Name        string
+	Preferences json.RawMessage
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Name, arg.Preferences)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Apikey,
+		&i.Preferences,
+		&i.IsAdmin,
+		&i.DisabledAt,
 	)
 	return i, err
 }
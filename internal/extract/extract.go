@@ -0,0 +1,328 @@
+// Package extract pulls the main article out of a web page, for feeds that
+// only carry a teaser. It follows the approach of Arc90's Readability: score
+// blocks of text by how much prose they hold, pick the best container and
+// keep the siblings that look like part of the same article.
+package extract
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/sanitize"
+)
+
+// ErrNoArticle is returned when nothing on the page looks like an article.
+var ErrNoArticle = errors.New("no article found on page")
+
+// minArticleLength is the least text, in bytes, accepted as an article.
+const minArticleLength = 250
+
+var (
+	unlikelyCandidates = regexp.MustCompile(
+		`(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|extra|foot|header|` +
+			`menu|modal|nav|pager|popup|promo|related|remark|rss|share|shoutbox|sidebar|` +
+			`social|sponsor|subscribe|tags|tool|widget|ad-break|agegate|pagination`,
+	)
+	maybeCandidate = regexp.MustCompile(`(?i)and|article|body|column|main|shadow|content`)
+	positiveNames  = regexp.MustCompile(
+		`(?i)article|body|content|entry|hentry|h-entry|main|page|post|text|blog|story`,
+	)
+	negativeNames = regexp.MustCompile(
+		`(?i)hidden|banner|combx|comment|com-|contact|foot|footer|footnote|masthead|media|` +
+			`meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|` +
+			`shopping|tags|tool|widget`,
+	)
+)
+
+// strippedTags never hold article text.
+var strippedTags = map[atom.Atom]bool{
+	atom.Aside:    true,
+	atom.Button:   true,
+	atom.Footer:   true,
+	atom.Form:     true,
+	atom.Header:   true,
+	atom.Iframe:   true,
+	atom.Input:    true,
+	atom.Nav:      true,
+	atom.Noscript: true,
+	atom.Script:   true,
+	atom.Select:   true,
+	atom.Style:    true,
+	atom.Svg:      true,
+	atom.Textarea: true,
+}
+
+// Article returns the sanitized HTML of the page's main article. body is
+// decoded using contentType and the page's own meta tags; relative links are
+// resolved against base.
+func Article(body []byte, contentType string, base *url.URL) (string, error) {
+	reader, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return "", err
+	}
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return "", err
+	}
+	if pageBase := findBase(doc, base); pageBase != nil {
+		base = pageBase
+	}
+
+	prune(doc)
+	top, scores := topCandidate(doc)
+	if top == nil {
+		return "", ErrNoArticle
+	}
+
+	var buf bytes.Buffer
+	for _, node := range articleNodes(top, scores) {
+		html.Render(&buf, node)
+	}
+	article := sanitize.HTML(buf.String(), base)
+	if len(sanitize.Text(article)) < minArticleLength {
+		return "", ErrNoArticle
+	}
+	return article, nil
+}
+
+// findBase honours a <base href> in the page.
+func findBase(doc *html.Node, pageURL *url.URL) *url.URL {
+	var base *url.URL
+	walk(doc, func(node *html.Node) bool {
+		if base != nil {
+			return false
+		}
+		if node.Type == html.ElementNode && node.DataAtom == atom.Base {
+			if href, err := url.Parse(attr(node, "href")); err == nil && pageURL != nil {
+				base = pageURL.ResolveReference(href)
+			}
+		}
+		return true
+	})
+	return base
+}
+
+// prune removes elements that are never part of the article, and ones whose
+// class or id says they're page furniture.
+func prune(node *html.Node) {
+	for child := node.FirstChild; child != nil; {
+		next := child.NextSibling
+		switch child.Type {
+		case html.CommentNode:
+			node.RemoveChild(child)
+		case html.ElementNode:
+			names := attr(child, "class") + " " + attr(child, "id")
+			unlikely := unlikelyCandidates.MatchString(names) &&
+				!maybeCandidate.MatchString(names) &&
+				child.DataAtom != atom.Body && child.DataAtom != atom.A
+			if strippedTags[child.DataAtom] || unlikely || isHidden(child) {
+				node.RemoveChild(child)
+			} else {
+				prune(child)
+			}
+		}
+		child = next
+	}
+}
+
+func isHidden(node *html.Node) bool {
+	style := strings.ReplaceAll(strings.ToLower(attr(node, "style")), " ", "")
+	return hasAttr(node, "hidden") || strings.Contains(style, "display:none") ||
+		strings.Contains(style, "visibility:hidden") || attr(node, "aria-hidden") == "true"
+}
+
+// topCandidate scores every paragraph-like block and credits its parent and
+// grandparent, then returns the highest scoring container after penalising
+// link-heavy ones, along with every container's score.
+func topCandidate(doc *html.Node) (*html.Node, map[*html.Node]float64) {
+	scores := map[*html.Node]float64{}
+	var candidates []*html.Node
+	addCandidate := func(node *html.Node) {
+		if _, ok := scores[node]; !ok {
+			scores[node] = initialScore(node)
+			candidates = append(candidates, node)
+		}
+	}
+
+	walk(doc, func(node *html.Node) bool {
+		if node.Type != html.ElementNode {
+			return true
+		}
+		switch node.DataAtom {
+		case atom.P, atom.Pre, atom.Td, atom.Blockquote:
+		default:
+			if node.DataAtom != atom.Div || hasBlockChildren(node) {
+				return true
+			}
+		}
+		text := innerText(node)
+		if len(text) < 25 || node.Parent == nil || node.Parent.Type != html.ElementNode {
+			return true
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+
+		parent := node.Parent
+		addCandidate(parent)
+		scores[parent] += score
+		if grandparent := parent.Parent; grandparent != nil &&
+			grandparent.Type == html.ElementNode {
+			addCandidate(grandparent)
+			scores[grandparent] += score / 2
+		}
+		return true
+	})
+
+	var top *html.Node
+	topScore := 0.0
+	for _, candidate := range candidates {
+		score := scores[candidate] * (1 - linkDensity(candidate))
+		scores[candidate] = score
+		if top == nil || score > topScore {
+			top, topScore = candidate, score
+		}
+	}
+	return top, scores
+}
+
+// articleNodes returns top along with any siblings that score close to it or
+// read like paragraphs of the same article.
+func articleNodes(top *html.Node, scores map[*html.Node]float64) []*html.Node {
+	if top.Parent == nil {
+		return []*html.Node{top}
+	}
+	threshold := math.Max(10, scores[top]*0.2)
+	var nodes []*html.Node
+	for sibling := top.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		if sibling == top {
+			nodes = append(nodes, sibling)
+			continue
+		}
+		if sibling.Type != html.ElementNode {
+			continue
+		}
+		if score, ok := scores[sibling]; ok && score >= threshold {
+			nodes = append(nodes, sibling)
+			continue
+		}
+		if sibling.DataAtom == atom.P {
+			text := innerText(sibling)
+			density := linkDensity(sibling)
+			if (len(text) > 80 && density < 0.25) ||
+				(len(text) > 0 && density == 0 && strings.Contains(text, ". ")) {
+				nodes = append(nodes, sibling)
+			}
+		}
+	}
+	return nodes
+}
+
+func initialScore(node *html.Node) float64 {
+	score := 0.0
+	switch node.DataAtom {
+	case atom.Article:
+		score = 10
+	case atom.Div, atom.Main, atom.Section:
+		score = 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score = 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score = -3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score = -5
+	}
+	for _, name := range []string{attr(node, "class"), attr(node, "id")} {
+		if name == "" {
+			continue
+		}
+		if negativeNames.MatchString(name) {
+			score -= 25
+		}
+		if positiveNames.MatchString(name) {
+			score += 25
+		}
+	}
+	if attr(node, "itemprop") == "articleBody" {
+		score += 25
+	}
+	return score
+}
+
+// hasBlockChildren reports whether a div holds other blocks, in which case its
+// paragraphs are scored rather than the div itself.
+func hasBlockChildren(node *html.Node) bool {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode {
+			continue
+		}
+		switch child.DataAtom {
+		case atom.A, atom.Blockquote, atom.Dl, atom.Div, atom.Img, atom.Ol, atom.P,
+			atom.Pre, atom.Table, atom.Ul, atom.Section, atom.Article, atom.Figure:
+			return true
+		}
+	}
+	return false
+}
+
+func linkDensity(node *html.Node) float64 {
+	textLength := len(innerText(node))
+	if textLength == 0 {
+		return 0
+	}
+	linkLength := 0
+	walk(node, func(child *html.Node) bool {
+		if child.Type == html.ElementNode && child.DataAtom == atom.A {
+			linkLength += len(innerText(child))
+			return false
+		}
+		return true
+	})
+	return float64(linkLength) / float64(textLength)
+}
+
+func innerText(node *html.Node) string {
+	var buf strings.Builder
+	walk(node, func(child *html.Node) bool {
+		if child.Type == html.TextNode {
+			buf.WriteString(child.Data)
+		}
+		return true
+	})
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+// walk calls visit on node and its descendants, depth first. Returning false
+// skips a node's children.
+func walk(node *html.Node, visit func(*html.Node) bool) {
+	if !visit(node) {
+		return
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		walk(child, visit)
+	}
+}
+
+func attr(node *html.Node, key string) string {
+	for _, a := range node.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(node *html.Node, key string) bool {
+	for _, a := range node.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+// Package fetcher is the HTTP client the scraper fetches feeds with, and the
+// image proxy fetches images with. One Client is shared by every worker so
+// connections to the same host are reused.
+package fetcher
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ErrTooLarge is returned when a response body is over Options.MaxBodyBytes.
+var ErrTooLarge = errors.New("response body too large")
+
+// Options configures a Client. Only ports 80 and 443 and public addresses are
+// fetched from by default; AllowedHosts and AllowedNetworks open that up for
+// intranet feeds, and AllowedPorts adds ports for any host.
+type Options struct {
+	Timeout         time.Duration
+	UserAgent       string
+	MaxBodyBytes    int64
+	MaxRedirects    int
+	AllowedHosts    []string
+	AllowedNetworks []string
+	AllowedPorts    []int
+}
+
+type Client struct {
+	http  *http.Client
+	opts  Options
+	guard *guard
+}
+
+// Response is a successful fetch. PermanentURL is set when every redirect
+// followed to get here was permanent (301 or 308), in which case the feed
+// should be fetched from there from now on.
+type Response struct {
+	Body         []byte
+	Header       http.Header
+	PermanentURL string
+}
+
+// StatusError is returned for responses outside 2xx. Header is kept as things
+// like Retry-After are still useful.
+type StatusError struct {
+	StatusCode int
+	Header     http.Header
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+var defaultDialer = &net.Dialer{
+	Timeout:   10 * time.Second,
+	KeepAlive: 30 * time.Second,
+}
+
+func New(opts Options) (*Client, error) {
+	g, err := newGuard(opts)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		// No proxy, the guard has to see the real destination address.
+		Proxy:                 nil,
+		DialContext:           g.dialContext(defaultDialer),
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   4,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: opts.Timeout,
+		// Accept-Encoding is set by hand to add brotli, which means the
+		// transport leaves decompression to us.
+		DisableCompression: true,
+	}
+	c := &Client{opts: opts, guard: g}
+	c.http = &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > opts.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects", opts.MaxRedirects)
+			}
+			return g.checkURL(req.URL)
+		},
+	}
+	return c, nil
+}
+
+const (
+	feedAccept  = "application/rss+xml, application/xml;q=0.9, text/xml;q=0.8, */*;q=0.1"
+	pageAccept  = "text/html, application/xhtml+xml;q=0.9, */*;q=0.1"
+	imageAccept = "image/avif, image/webp, image/png, image/jpeg, image/gif;q=0.9, */*;q=0.1"
+)
+
+// Fetch gets a feed.
+func (c *Client) Fetch(ctx context.Context, url string) (*Response, error) {
+	return c.fetch(ctx, url, feedAccept)
+}
+
+// FetchPage gets a web page, such as the article a post links to.
+func (c *Client) FetchPage(ctx context.Context, url string) (*Response, error) {
+	return c.fetch(ctx, url, pageAccept)
+}
+
+// FetchImage gets an image for the image proxy.
+func (c *Client) FetchImage(ctx context.Context, url string) (*Response, error) {
+	return c.fetch(ctx, url, imageAccept)
+}
+
+func (c *Client) fetch(ctx context.Context, url string, accept string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.guard.checkURL(req.URL); err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// Drain what's left so the connection goes back in the pool.
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Header: resp.Header}
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	// Read one byte past the limit to tell a body that fits exactly apart
+	// from one that's too large.
+	dat, err := io.ReadAll(io.LimitReader(body, c.opts.MaxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(dat)) > c.opts.MaxBodyBytes {
+		return nil, ErrTooLarge
+	}
+
+	return &Response{
+		Body:         dat,
+		Header:       resp.Header,
+		PermanentURL: permanentURL(resp),
+	}, nil
+}
+
+func decodeBody(resp *http.Response) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return resp.Body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	case "br":
+		return brotli.NewReader(resp.Body), nil
+	default:
+		return nil, fmt.Errorf(
+			"unsupported content encoding %q",
+			resp.Header.Get("Content-Encoding"),
+		)
+	}
+}
+
+// permanentURL walks back through the redirects that led to resp and returns
+// the final URL if they were all permanent.
+func permanentURL(resp *http.Response) string {
+	if resp.Request.Response == nil {
+		return ""
+	}
+	for hop := resp.Request.Response; hop != nil; hop = hop.Request.Response {
+		if hop.StatusCode != http.StatusMovedPermanently &&
+			hop.StatusCode != http.StatusPermanentRedirect {
+			return ""
+		}
+	}
+	return resp.Request.URL.String()
+}
+
+// NormalizeFeedURL validates a feed URL and puts it in one canonical form, so
+// the same feed can't be tracked twice under URLs that only differ in case or
+// a default port.
+func NormalizeFeedURL(rawUrl string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawUrl))
+	if err != nil || u.Hostname() == "" {
+		return "", errors.New("Invalid feed url")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.New("Feed url must be http or https")
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+	u.Fragment = ""
+	return u.String(), nil
+}
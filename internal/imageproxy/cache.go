@@ -0,0 +1,98 @@
+package imageproxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cache keeps images on disk, one file per image URL named after its hash.
+// A file holds the content type on the first line followed by the image, and
+// its modification time is when the image was fetched.
+type cache struct {
+	dir string
+	ttl time.Duration
+}
+
+func newCache(dir string, ttl time.Duration) (*cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating image cache: %w", err)
+	}
+	return &cache{dir: dir, ttl: ttl}, nil
+}
+
+func (c *cache) path(imageURL string) string {
+	sum := sha256.Sum256([]byte(imageURL))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+}
+
+func (c *cache) get(imageURL string) (Image, bool) {
+	path := c.path(imageURL)
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > c.ttl {
+		return Image{}, false
+	}
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return Image{}, false
+	}
+	contentType, body, ok := bytes.Cut(dat, []byte("\n"))
+	if !ok {
+		return Image{}, false
+	}
+	return Image{
+		ContentType: string(contentType),
+		Body:        body,
+		FetchedAt:   info.ModTime().UTC(),
+	}, true
+}
+
+// put writes through a temporary file so readers never see half an image.
+func (c *cache) put(imageURL string, img Image) {
+	tmp, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		log.Printf("Couldn't cache image %s: %v", imageURL, err)
+		return
+	}
+	_, err = fmt.Fprintf(tmp, "%s\n", img.ContentType)
+	if err == nil {
+		_, err = tmp.Write(img.Body)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(imageURL))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("Couldn't cache image %s: %v", imageURL, err)
+	}
+}
+
+// sweep removes expired images, and temporary files left behind by a crash.
+func (c *cache) sweep() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		log.Printf("Couldn't sweep image cache: %v", err)
+		return
+	}
+	removed := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || time.Since(info.ModTime()) <= c.ttl {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, entry.Name())); err == nil {
+			removed++
+		}
+	}
+	if removed > 0 {
+		log.Printf("Removed %d expired images from the cache", removed)
+	}
+}
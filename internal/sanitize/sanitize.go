@@ -0,0 +1,384 @@
+// Package sanitize cleans HTML from feeds before it is stored or served. Only
+// an allowlist of formatting tags and attributes survives, links are made
+// absolute and tracking pixels are dropped.
+package sanitize
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// allowedAttrs lists the tags that are kept and the attributes kept on them.
+// Other tags are unwrapped, keeping their children, unless they're dropped.
+var allowedAttrs = map[atom.Atom][]string{
+	atom.A:          {"href", "title"},
+	atom.Abbr:       {"title"},
+	atom.B:          nil,
+	atom.Blockquote: {"cite"},
+	atom.Br:         nil,
+	atom.Cite:       nil,
+	atom.Code:       nil,
+	atom.Dd:         nil,
+	atom.Del:        nil,
+	atom.Div:        nil,
+	atom.Dl:         nil,
+	atom.Dt:         nil,
+	atom.Em:         nil,
+	atom.Figcaption: nil,
+	atom.Figure:     nil,
+	atom.H1:         nil,
+	atom.H2:         nil,
+	atom.H3:         nil,
+	atom.H4:         nil,
+	atom.H5:         nil,
+	atom.H6:         nil,
+	atom.Hr:         nil,
+	atom.I:          nil,
+	atom.Img:        {"src", "alt", "title", "width", "height"},
+	atom.Ins:        nil,
+	atom.Li:         nil,
+	atom.Mark:       nil,
+	atom.Ol:         {"start"},
+	atom.P:          nil,
+	atom.Pre:        nil,
+	atom.Q:          {"cite"},
+	atom.S:          nil,
+	atom.Small:      nil,
+	atom.Span:       nil,
+	atom.Strong:     nil,
+	atom.Sub:        nil,
+	atom.Sup:        nil,
+	atom.Table:      nil,
+	atom.Tbody:      nil,
+	atom.Td:         {"colspan", "rowspan"},
+	atom.Tfoot:      nil,
+	atom.Th:         {"colspan", "rowspan"},
+	atom.Thead:      nil,
+	atom.Tr:         nil,
+	atom.U:          nil,
+	atom.Ul:         nil,
+}
+
+// droppedTags are removed along with everything inside them.
+var droppedTags = map[atom.Atom]bool{
+	atom.Applet:   true,
+	atom.Button:   true,
+	atom.Embed:    true,
+	atom.Form:     true,
+	atom.Frame:    true,
+	atom.Frameset: true,
+	atom.Head:     true,
+	atom.Iframe:   true,
+	atom.Input:    true,
+	atom.Math:     true,
+	atom.Noscript: true,
+	atom.Object:   true,
+	atom.Script:   true,
+	atom.Select:   true,
+	atom.Style:    true,
+	atom.Svg:      true,
+	atom.Template: true,
+	atom.Textarea: true,
+	atom.Title:    true,
+}
+
+// trackerHosts serve the invisible images feeds embed to count readers.
+var trackerHosts = map[string]bool{
+	"feeds.feedburner.com":     true,
+	"pixel.wp.com":             true,
+	"stats.wordpress.com":      true,
+	"www.google-analytics.com": true,
+	"pixel.quantserve.com":     true,
+	"medium.com":               true,
+}
+
+// HTML returns raw with everything but the allowlisted markup removed.
+// Relative links and image sources are resolved against base, which may be
+// nil.
+func HTML(raw string, base *url.URL) string {
+	nodes, err := parseFragment(raw)
+	if err != nil {
+		return html.EscapeString(raw)
+	}
+	var buf bytes.Buffer
+	for _, node := range nodes {
+		for _, clean := range sanitizeNode(node, base) {
+			html.Render(&buf, clean)
+		}
+	}
+	return buf.String()
+}
+
+// URL returns raw resolved against base, which may be nil, if it's an http or
+// https URL, and empty otherwise.
+func URL(raw string, base *url.URL) string {
+	if strings.TrimSpace(raw) == "" {
+		return ""
+	}
+	resolved, ok := resolveURL(raw, base, false)
+	if !ok {
+		return ""
+	}
+	return resolved
+}
+
+// RewriteImages replaces the src of every image in html, which should already
+// be sanitized, with what rewrite returns for it.
+func RewriteImages(raw string, rewrite func(src string) string) string {
+	if !strings.Contains(raw, "<img") {
+		return raw
+	}
+	nodes, err := parseFragment(raw)
+	if err != nil {
+		return raw
+	}
+	var buf bytes.Buffer
+	for _, node := range nodes {
+		rewriteImages(node, rewrite)
+		html.Render(&buf, node)
+	}
+	return buf.String()
+}
+
+func rewriteImages(node *html.Node, rewrite func(src string) string) {
+	if node.Type == html.ElementNode && node.DataAtom == atom.Img {
+		for i, attr := range node.Attr {
+			if attr.Key == "src" {
+				node.Attr[i].Val = rewrite(attr.Val)
+			}
+		}
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		rewriteImages(child, rewrite)
+	}
+}
+
+// Text returns the text of raw with the markup removed and whitespace
+// collapsed.
+func Text(raw string) string {
+	nodes, err := parseFragment(raw)
+	if err != nil {
+		return collapseSpace(raw)
+	}
+	var buf strings.Builder
+	for _, node := range nodes {
+		writeText(&buf, node)
+	}
+	return collapseSpace(buf.String())
+}
+
+// Excerpt is Text cut to at most maxRunes, at a word boundary where possible.
+func Excerpt(raw string, maxRunes int) string {
+	text := Text(raw)
+	if utf8.RuneCountInString(text) <= maxRunes {
+		return text
+	}
+	runes := []rune(text)[:maxRunes]
+	cut := len(runes)
+	for i := len(runes) - 1; i > maxRunes/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + "…"
+}
+
+// PostExcerptLength is how long the excerpts stored for posts are.
+const PostExcerptLength = 280
+
+// PostExcerpt is a plain text preview of a post, from its description or, for
+// feeds that only have full content, its content.
+func PostExcerpt(description, content string) string {
+	if excerpt := Excerpt(description, PostExcerptLength); excerpt != "" {
+		return excerpt
+	}
+	return Excerpt(content, PostExcerptLength)
+}
+
+func parseFragment(raw string) ([]*html.Node, error) {
+	return html.ParseFragment(strings.NewReader(raw), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "div",
+		DataAtom: atom.Div,
+	})
+}
+
+func sanitizeNode(node *html.Node, base *url.URL) []*html.Node {
+	switch node.Type {
+	case html.TextNode:
+		return []*html.Node{{Type: html.TextNode, Data: node.Data}}
+	case html.ElementNode:
+	default:
+		return nil
+	}
+	if droppedTags[node.DataAtom] {
+		return nil
+	}
+
+	var children []*html.Node
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		children = append(children, sanitizeNode(child, base)...)
+	}
+	allowed, ok := allowedAttrs[node.DataAtom]
+	if !ok || node.Namespace != "" {
+		return children
+	}
+
+	clean := &html.Node{Type: html.ElementNode, Data: node.Data, DataAtom: node.DataAtom}
+	for _, attr := range node.Attr {
+		if attr.Namespace != "" || !contains(allowed, attr.Key) {
+			continue
+		}
+		if attr.Key == "href" || attr.Key == "src" || attr.Key == "cite" {
+			resolved, ok := resolveURL(attr.Val, base, attr.Key == "href")
+			if !ok {
+				continue
+			}
+			attr.Val = resolved
+		}
+		clean.Attr = append(clean.Attr, html.Attribute{Key: attr.Key, Val: attr.Val})
+	}
+	switch node.DataAtom {
+	case atom.A:
+		clean.Attr = append(clean.Attr, html.Attribute{
+			Key: "rel",
+			Val: "nofollow noopener noreferrer",
+		})
+	case atom.Img:
+		if isTrackingPixel(clean) {
+			return nil
+		}
+	}
+	for _, child := range children {
+		clean.AppendChild(child)
+	}
+	return []*html.Node{clean}
+}
+
+// resolveURL makes raw absolute against base and reports whether it uses a
+// safe scheme. mailto: is only allowed for links.
+func resolveURL(raw string, base *url.URL, isLink bool) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.String(), true
+	case "mailto":
+		return u.String(), isLink
+	}
+	return "", false
+}
+
+func isTrackingPixel(img *html.Node) bool {
+	src := ""
+	width, height := -1, -1
+	for _, attr := range img.Attr {
+		switch attr.Key {
+		case "src":
+			src = attr.Val
+		case "width":
+			width = parseDimension(attr.Val)
+		case "height":
+			height = parseDimension(attr.Val)
+		}
+	}
+	if src == "" {
+		return true
+	}
+	if width >= 0 && width <= 1 && height >= 0 && height <= 1 {
+		return true
+	}
+	u, err := url.Parse(src)
+	if err != nil {
+		return true
+	}
+	host := strings.ToLower(u.Hostname())
+	if !trackerHosts[host] {
+		return false
+	}
+	// Feedburner and Medium serve real content too, only their stat paths
+	// are trackers.
+	switch host {
+	case "feeds.feedburner.com":
+		return strings.HasPrefix(u.Path, "/~r/") || strings.HasPrefix(u.Path, "/~ff/")
+	case "medium.com":
+		return strings.HasPrefix(u.Path, "/_/stat")
+	}
+	return true
+}
+
+func parseDimension(s string) int {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s), "px"))
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+var blockTags = map[atom.Atom]bool{
+	atom.Blockquote: true,
+	atom.Br:         true,
+	atom.Dd:         true,
+	atom.Div:        true,
+	atom.Dt:         true,
+	atom.Figcaption: true,
+	atom.H1:         true,
+	atom.H2:         true,
+	atom.H3:         true,
+	atom.H4:         true,
+	atom.H5:         true,
+	atom.H6:         true,
+	atom.Hr:         true,
+	atom.Li:         true,
+	atom.P:          true,
+	atom.Pre:        true,
+	atom.Td:         true,
+	atom.Th:         true,
+	atom.Tr:         true,
+}
+
+func writeText(buf *strings.Builder, node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		buf.WriteString(node.Data)
+		return
+	case html.ElementNode:
+		if droppedTags[node.DataAtom] {
+			return
+		}
+	default:
+		return
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		writeText(buf, child)
+	}
+	if blockTags[node.DataAtom] {
+		buf.WriteByte(' ')
+	}
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package scraper
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/internal/sanitize"
+)
+
+const sanitizeBatchSize = 100
+
+// sanitizeLegacyPosts sanitizes, a batch at a time, the posts stored before
+// their HTML was sanitized at ingest, until there are none left or stop is
+// closed. Instances racing over a batch just do the same work twice.
+func (s *Scraper) sanitizeLegacyPosts(ctx context.Context, stop <-chan struct{}) {
+	sanitized := 0
+	for !stopped(ctx, stop) {
+		posts, err := s.DB.GetUnsanitizedPosts(ctx, sanitizeBatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Couldn't get posts to sanitize: %v", err)
+			}
+			return
+		}
+		for _, post := range posts {
+			base := postBaseURL(post.Url, post.FeedUrl)
+			err := s.DB.SetPostSanitizedHTML(ctx, database.SetPostSanitizedHTMLParams{
+				ID:          post.ID,
+				Description: sanitize.HTML(post.RawDescription, base),
+				Content:     sanitize.HTML(post.RawContent, base),
+				Excerpt:     sanitize.PostExcerpt(post.RawDescription, post.RawContent),
+			})
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Couldn't save sanitized post %s: %v", post.ID, err)
+				}
+				return
+			}
+			sanitized++
+		}
+		if len(posts) < sanitizeBatchSize {
+			break
+		}
+	}
+	if sanitized > 0 {
+		log.Printf("Sanitized %d posts stored before sanitizing at ingest", sanitized)
+	}
+}
+
+// postBaseURL is what relative links in a stored post are resolved against:
+// its own URL, or failing that its feed's.
+func postBaseURL(postURL, feedURL string) *url.URL {
+	for _, candidate := range []string{postURL, feedURL} {
+		base, err := url.Parse(strings.TrimSpace(candidate))
+		if err == nil && base.IsAbs() {
+			return base
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package scraper
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"regexp"
+
+	"golang.org/x/net/html/charset"
+)
+
+var byteOrderMarks = []struct {
+	mark     []byte
+	encoding string
+}{
+	{[]byte{0xEF, 0xBB, 0xBF}, "utf-8"},
+	{[]byte{0xFE, 0xFF}, "utf-16be"},
+	{[]byte{0xFF, 0xFE}, "utf-16le"},
+}
+
+var xmlDeclEncoding = regexp.MustCompile(`^\s*<\?xml[^>]*\sencoding\s*=\s*["']([^"']+)["']`)
+
+// toUTF8 transcodes body to UTF-8. The encoding is taken from, in order: a
+// byte order mark, the charset in the Content-Type header, and the XML
+// declaration. The name of the encoding is returned along with the body.
+func toUTF8(body []byte, contentType string) ([]byte, string, error) {
+	label := ""
+	for _, bom := range byteOrderMarks {
+		if bytes.HasPrefix(body, bom.mark) {
+			label = bom.encoding
+			body = body[len(bom.mark):]
+			break
+		}
+	}
+	if label == "" {
+		if _, params, err := mime.ParseMediaType(contentType); err == nil {
+			label = params["charset"]
+		}
+	}
+	if label == "" {
+		head := body
+		if len(head) > 1024 {
+			head = head[:1024]
+		}
+		if match := xmlDeclEncoding.FindSubmatch(head); match != nil {
+			label = string(match[1])
+		}
+	}
+	if label == "" {
+		return body, "utf-8", nil
+	}
+
+	enc, name := charset.Lookup(label)
+	if enc == nil {
+		return nil, label, fmt.Errorf("unsupported charset %q", label)
+	}
+	if name == "utf-8" {
+		return body, name, nil
+	}
+	transcoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, name, fmt.Errorf("decoding %s: %w", name, err)
+	}
+	return transcoded, name, nil
+}
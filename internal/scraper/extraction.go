@@ -0,0 +1,117 @@
+package scraper
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/internal/extract"
+	"github.com/AxterDoesCode/blogAggregator/internal/fetcher"
+)
+
+// Extractor fetches the full article for new posts from feeds that opted in
+// with fetch_full_content, for feeds that only carry a teaser. Posts are
+// claimed with a lease like feeds are, so it can run on several instances.
+// A failed post is retried after RetryDelay until MaxAttempts is reached.
+type Extractor struct {
+	DB            *database.Queries
+	Fetcher       *fetcher.Client
+	Workers       int
+	PollInterval  time.Duration
+	LeaseDuration time.Duration
+	RetryDelay    time.Duration
+	MaxAttempts   int
+}
+
+// Run extracts articles until stop is closed, finishing the batch it's on.
+// ctx is for the in-flight work, cancelling it abandons the batch.
+func (e *Extractor) Run(ctx context.Context, stop <-chan struct{}) {
+	log.Printf("Starting article extraction on %v workers", e.Workers)
+	ticker := time.NewTicker(e.PollInterval)
+	defer ticker.Stop()
+	defer log.Println("Stopped article extraction")
+
+	for !stopped(ctx, stop) {
+		// Keep going while there's a backlog, otherwise wait for more.
+		if e.extractPending(ctx) == e.Workers {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// extractPending claims a batch of posts, extracts them concurrently and
+// returns how many it claimed.
+func (e *Extractor) extractPending(ctx context.Context) int {
+	posts, err := e.DB.ClaimPendingExtractions(ctx, database.ClaimPendingExtractionsParams{
+		LeaseSeconds: e.LeaseDuration.Seconds(),
+		MaxPosts:     int32(e.Workers),
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Couldn't claim posts to extract: %v", err)
+		}
+		return 0
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, post := range posts {
+		wg.Add(1)
+		go func(post database.Post) {
+			defer wg.Done()
+			e.extractPost(ctx, post)
+		}(post)
+	}
+	wg.Wait()
+	return len(posts)
+}
+
+func (e *Extractor) extractPost(ctx context.Context, post database.Post) {
+	article, err := e.fetchArticle(ctx, post.Url)
+	if ctx.Err() != nil {
+		// Shutting down, the lease runs out and another worker retries.
+		return
+	}
+	if err != nil {
+		log.Printf("Couldn't extract article for post %s: %v", post.Title, err)
+		err = e.DB.FailExtraction(ctx, database.FailExtractionParams{
+			ExtractionError:   err.Error(),
+			MaxAttempts:       int32(e.MaxAttempts),
+			RetryDelaySeconds: e.RetryDelay.Seconds(),
+			ID:                post.ID,
+		})
+		if err != nil {
+			log.Printf("Couldn't record extraction failure for post %s: %v", post.Title, err)
+		}
+		return
+	}
+
+	err = e.DB.CompleteExtraction(ctx, database.CompleteExtractionParams{
+		ID:          post.ID,
+		FullContent: article,
+	})
+	if err != nil {
+		log.Printf("Couldn't save extracted article for post %s: %v", post.Title, err)
+	}
+}
+
+func (e *Extractor) fetchArticle(ctx context.Context, postURL string) (string, error) {
+	base, err := url.Parse(postURL)
+	if err != nil {
+		return "", err
+	}
+	resp, err := e.Fetcher.FetchPage(ctx, postURL)
+	if err != nil {
+		return "", err
+	}
+	return extract.Article(resp.Body, resp.Header.Get("Content-Type"), base)
+}
@@ -0,0 +1,201 @@
+package scraper
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IntervalPolicy bounds how often a feed is polled. Within those bounds the
+// interval follows how often the feed actually posts, and never polls faster
+// than the publisher asks through <ttl>, sy:updatePeriod or Cache-Control.
+type IntervalPolicy struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// recentPostsForInterval is how many of the newest items are used to measure
+// a feed's posting frequency.
+const recentPostsForInterval = 20
+
+// nextFetch returns the feed's new polling interval and how long to wait
+// before fetching it again. The two differ when a failed fetch, Retry-After,
+// skipHours or skipDays push a single fetch back without changing the feed's
+// pace.
+func (p IntervalPolicy) nextFetch(
+	current time.Duration,
+	override time.Duration,
+	result *fetchResult,
+	fetchErr error,
+	now time.Time,
+) (time.Duration, time.Duration) {
+	interval := current
+	switch {
+	case fetchErr != nil:
+		// Keep the pace, a transient outage shouldn't slow the feed down
+		// for good.
+	case override > 0:
+		interval = override
+	case result != nil && result.Feed != nil:
+		if observed, ok := postingInterval(result.Feed, now); ok {
+			interval = observed
+		}
+		interval = maxDuration(interval, publisherInterval(result.Feed))
+		interval = maxDuration(interval, result.MaxAge)
+	}
+	interval = p.clamp(interval)
+
+	delay := interval
+	if fetchErr != nil {
+		delay = p.clamp(interval * 2)
+	}
+	if result != nil {
+		delay = maxDuration(delay, minDuration(result.RetryAfter, p.Max))
+		if result.Feed != nil {
+			delay = minDuration(skipBlockedTimes(result.Feed, now, delay), p.Max)
+		}
+	}
+	return interval, delay
+}
+
+func (p IntervalPolicy) clamp(d time.Duration) time.Duration {
+	if d < p.Min {
+		return p.Min
+	}
+	if d > p.Max {
+		return p.Max
+	}
+	return d
+}
+
+// postingInterval polls at half the average gap between recent posts, so a
+// new post waits on average a quarter of the gap before it's picked up. A
+// feed that has gone quiet for longer than its usual gap slows down further.
+func postingInterval(feed *RSSFeed, now time.Time) (time.Duration, bool) {
+	var dates []time.Time
+	for _, item := range feed.Channel.Item {
+		if t, ok := parsePubDate(item.PubDate); ok && !t.After(now) {
+			dates = append(dates, t)
+		}
+	}
+	if len(dates) < 2 {
+		return 0, false
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].After(dates[j]) })
+	if len(dates) > recentPostsForInterval {
+		dates = dates[:recentPostsForInterval]
+	}
+
+	newest := dates[0]
+	oldest := dates[len(dates)-1]
+	averageGap := newest.Sub(oldest) / time.Duration(len(dates)-1)
+	interval := averageGap / 2
+	if quiet := now.Sub(newest); quiet > averageGap {
+		interval = maxDuration(interval, quiet/4)
+	}
+	return interval, true
+}
+
+// publisherInterval is the shortest interval the feed says it may be polled
+// at, from <ttl> (in minutes) and the syndication module's update period.
+func publisherInterval(feed *RSSFeed) time.Duration {
+	var interval time.Duration
+	if ttl, err := strconv.Atoi(strings.TrimSpace(feed.Channel.TTL)); err == nil && ttl > 0 {
+		interval = time.Duration(ttl) * time.Minute
+	}
+
+	periods := map[string]time.Duration{
+		"hourly":  time.Hour,
+		"daily":   24 * time.Hour,
+		"weekly":  7 * 24 * time.Hour,
+		"monthly": 30 * 24 * time.Hour,
+		"yearly":  365 * 24 * time.Hour,
+	}
+	if period, ok := periods[strings.ToLower(strings.TrimSpace(feed.Channel.UpdatePeriod))]; ok {
+		frequency, err := strconv.Atoi(strings.TrimSpace(feed.Channel.UpdateFrequency))
+		if err != nil || frequency < 1 {
+			frequency = 1
+		}
+		interval = maxDuration(interval, period/time.Duration(frequency))
+	}
+	return interval
+}
+
+// skipBlockedTimes pushes now+delay past any hours (GMT) and days the feed
+// lists in <skipHours> and <skipDays>. Hints that block every hour of the
+// week are ignored.
+func skipBlockedTimes(feed *RSSFeed, now time.Time, delay time.Duration) time.Duration {
+	skipHours := map[int]bool{}
+	for _, h := range feed.Channel.SkipHours {
+		if hour, err := strconv.Atoi(strings.TrimSpace(h)); err == nil {
+			skipHours[hour%24] = true
+		}
+	}
+	skipDays := map[string]bool{}
+	for _, d := range feed.Channel.SkipDays {
+		skipDays[strings.ToLower(strings.TrimSpace(d))] = true
+	}
+	if len(skipHours) == 0 && len(skipDays) == 0 {
+		return delay
+	}
+
+	next := now.Add(delay).UTC()
+	for i := 0; i < 8*24; i++ {
+		day := strings.ToLower(next.Weekday().String())
+		if !skipHours[next.Hour()] && !skipDays[day] {
+			return next.Sub(now)
+		}
+		next = next.Truncate(time.Hour).Add(time.Hour)
+	}
+	return delay
+}
+
+// parseMaxAge reads max-age from a Cache-Control header, treating no-cache
+// and no-store as no hint at all.
+func parseMaxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return 0
+}
+
+// parseRetryAfter accepts both forms of Retry-After: delay seconds and an
+// HTTP date.
+func parseRetryAfter(retryAfter string, now time.Time) time.Duration {
+	retryAfter = strings.TrimSpace(retryAfter)
+	if retryAfter == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(retryAfter); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
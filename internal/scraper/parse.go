@@ -0,0 +1,83 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// parsedFeed is a decoded feed and what it took to decode it. Repair is empty
+// when the document was well formed, otherwise it says what was wrong.
+type parsedFeed struct {
+	Feed     *RSSFeed
+	Encoding string
+	Repair   string
+}
+
+// decodeFeed parses body strictly first, then falls back to a tolerant parse
+// of a cleaned up copy for the malformed feeds that are common in the wild.
+func decodeFeed(body []byte, contentType string) (*parsedFeed, error) {
+	body, encoding, err := toUTF8(body, contentType)
+	if err != nil {
+		return &parsedFeed{Encoding: encoding}, err
+	}
+	parsed := &parsedFeed{Encoding: encoding}
+
+	var rssFeed RSSFeed
+	strictErr := newFeedDecoder(body, true).Decode(&rssFeed)
+	if strictErr == nil {
+		parsed.Feed = &rssFeed
+		return parsed, nil
+	}
+
+	rssFeed = RSSFeed{}
+	err = newFeedDecoder(cleanXML(body), false).Decode(&rssFeed)
+	if len(rssFeed.Channel.Item) == 0 {
+		// Nothing was rescued, so the feed is as broken as the strict parse
+		// said.
+		return parsed, strictErr
+	}
+	parsed.Feed = &rssFeed
+	parsed.Repair = fmt.Sprintf("malformed XML: %v", strictErr)
+	if err != nil {
+		// Items decoded before the error are kept, the rest are lost.
+		parsed.Repair += fmt.Sprintf("; kept the first %d items", len(rssFeed.Channel.Item))
+		if err.Error() != strictErr.Error() {
+			parsed.Repair += fmt.Sprintf(", then: %v", err)
+		}
+	}
+	return parsed, nil
+}
+
+func newFeedDecoder(body []byte, strict bool) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	// body has already been transcoded, whatever the declaration says.
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if !strict {
+		// Unknown entities and bare ampersands are kept as text, and HTML
+		// entities like &nbsp; are understood.
+		// AutoClose is left alone: HTML's list would make <link> void.
+		decoder.Strict = false
+		decoder.Entity = xml.HTMLEntity
+	}
+	return decoder
+}
+
+// cleanXML drops anything before the first tag, invalid UTF-8 and control
+// characters XML doesn't allow.
+func cleanXML(body []byte) []byte {
+	if i := bytes.IndexByte(body, '<'); i > 0 {
+		body = body[i:]
+	}
+	return []byte(strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || (r < 0x20 && r != '\t' && r != '\n' && r != '\r') {
+			return -1
+		}
+		return r
+	}, string(body)))
+}
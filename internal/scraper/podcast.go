@@ -0,0 +1,89 @@
+package scraper
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/sanitize"
+)
+
+// podcastEpisode is what an item's enclosure and itunes: tags say about it as
+// a podcast episode. Numbers are zero when the feed doesn't give them.
+type podcastEpisode struct {
+	DurationSeconds int32
+	Episode         int32
+	Season          int32
+	Explicit        bool
+	ArtworkURL      string
+}
+
+// podcastEpisode reports whether the item is an episode, that is it has an
+// audio or video enclosure or any itunes: episode tags, and if so its details.
+// Artwork and the explicit flag fall back to the channel's. Artwork is
+// resolved against base and kept only if it's an http or https URL.
+func (item RSSItem) podcastEpisode(
+	channelArtwork string,
+	channelExplicit string,
+	base *url.URL,
+) (podcastEpisode, bool) {
+	isEpisode := item.ITunesDuration != "" || item.ITunesEpisode != "" ||
+		item.ITunesSeason != ""
+	for _, enclosure := range item.Enclosures {
+		mediaType := strings.ToLower(enclosure.Type)
+		if strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/") {
+			isEpisode = true
+		}
+	}
+	if !isEpisode {
+		return podcastEpisode{}, false
+	}
+
+	episode := podcastEpisode{
+		DurationSeconds: parseITunesDuration(item.ITunesDuration),
+		Episode:         parseInt32(item.ITunesEpisode),
+		Season:          parseInt32(item.ITunesSeason),
+		Explicit:        parseITunesExplicit(item.ITunesExplicit),
+		ArtworkURL:      sanitize.URL(item.ITunesImage.Href, base),
+	}
+	if item.ITunesExplicit == "" {
+		episode.Explicit = parseITunesExplicit(channelExplicit)
+	}
+	if episode.ArtworkURL == "" {
+		episode.ArtworkURL = sanitize.URL(channelArtwork, base)
+	}
+	return episode, true
+}
+
+// parseITunesDuration accepts seconds, MM:SS and HH:MM:SS.
+func parseITunesDuration(s string) int32 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	seconds := 0
+	for _, part := range strings.Split(s, ":") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 {
+			return 0
+		}
+		seconds = seconds*60 + n
+	}
+	return int32(seconds)
+}
+
+func parseITunesExplicit(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "yes", "true", "explicit":
+		return true
+	}
+	return false
+}
+
+func parseInt32(s string) int32 {
+	n, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return int32(n)
+}
@@ -0,0 +1,209 @@
+package scraper
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/internal/sanitize"
+)
+
+type postCounts struct {
+	Inserted int
+	Updated  int
+	Skipped  int
+}
+
+// errLeaseLost is returned when the feed's lease was taken away mid-fetch.
+var errLeaseLost = errors.New("lease on feed lost")
+
+// itemBaseURL is what relative links in an item are resolved against: its own
+// link, or failing that the channel's, or the feed's URL.
+func itemBaseURL(item RSSItem, rssFeed *RSSFeed, feed database.Feed) *url.URL {
+	for _, candidate := range []string{item.Link, rssFeed.Channel.Link, feed.Url} {
+		base, err := url.Parse(strings.TrimSpace(candidate))
+		if err == nil && base.IsAbs() {
+			return base
+		}
+	}
+	return nil
+}
+
+// savePosts upserts a feed's items, with their categories, enclosures and
+// podcast details, in one transaction and a handful of queries, so a feed is
+// either fully ingested or not at all. Items that are already stored and
+// unchanged are skipped.
+func (s *Scraper) savePosts(
+	ctx context.Context,
+	feed database.Feed,
+	rssFeed *RSSFeed,
+) (postCounts, error) {
+	items := rssFeed.Channel.Item
+	counts := postCounts{}
+	params := database.UpsertPostsParams{
+		Now:    time.Now().UTC(),
+		FeedID: feed.ID,
+	}
+	byKey := map[string]RSSItem{}
+	legacy := database.AdoptLegacyPostKeysParams{FeedID: feed.ID}
+	for _, item := range items {
+		key := item.dedupKey()
+		if _, ok := byKey[key]; ok {
+			// Postgres can't upsert the same row twice in one statement.
+			counts.Skipped++
+			continue
+		}
+		if legacyKey := item.legacyDedupKey(); legacyKey != key {
+			legacy.LegacyKeys = append(legacy.LegacyKeys, legacyKey)
+			legacy.DedupKeys = append(legacy.DedupKeys, key)
+		}
+		// Only http and https links are kept, so a feed can't slip a
+		// javascript: URL into a link we render.
+		base := itemBaseURL(item, rssFeed, feed)
+		item.Link = sanitize.URL(item.Link, base)
+		byKey[key] = item
+
+		publishedAt := ""
+		if t, ok := parsePubDate(item.PubDate); ok {
+			publishedAt = t.UTC().Format(time.RFC3339Nano)
+		}
+		params.Ids = append(params.Ids, uuid.New())
+		params.Titles = append(params.Titles, item.Title)
+		params.Urls = append(params.Urls, item.Link)
+		params.Descriptions = append(params.Descriptions, sanitize.HTML(item.Description, base))
+		params.PublishedAts = append(params.PublishedAts, publishedAt)
+		params.Guids = append(params.Guids, strings.TrimSpace(item.GUID))
+		params.Authors = append(params.Authors, item.author())
+		params.Contents = append(params.Contents, sanitize.HTML(item.Content, base))
+		params.ThumbnailUrls = append(params.ThumbnailUrls, item.thumbnailURL(base))
+		params.DedupKeys = append(params.DedupKeys, key)
+		params.RawDescriptions = append(params.RawDescriptions, item.Description)
+		params.RawContents = append(params.RawContents, item.Content)
+		params.Excerpts = append(params.Excerpts, sanitize.PostExcerpt(item.Description, item.Content))
+	}
+	if len(params.Ids) == 0 {
+		return counts, nil
+	}
+
+	tx, err := s.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return counts, err
+	}
+	defer tx.Rollback()
+	qtx := s.DB.WithTx(tx)
+
+	// Editing a feed's URL takes away its lease, and the posts we fetched
+	// from the old URL don't belong to it any more. Holding the row also keeps
+	// an edit from landing halfway through.
+	_, err = qtx.LockLeasedFeed(ctx, database.LockLeasedFeedParams{
+		ID:         feed.ID,
+		LeaseOwner: s.leaseOwner(),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return counts, errLeaseLost
+	}
+	if err != nil {
+		return counts, err
+	}
+
+	// Posts stored before GUIDs were kept are keyed by link or text. They're
+	// moved over to their GUID key so the upsert updates them rather than
+	// adding a copy.
+	if len(legacy.LegacyKeys) > 0 {
+		if err := qtx.AdoptLegacyPostKeys(ctx, legacy); err != nil {
+			return counts, err
+		}
+	}
+	saved, err := qtx.UpsertPosts(ctx, params)
+	if err != nil {
+		return counts, err
+	}
+	categories := database.CreatePostCategoriesParams{}
+	enclosures := database.CreatePostEnclosuresParams{}
+	episodes := database.UpsertPodcastEpisodesParams{}
+	var toExtract, updated []uuid.UUID
+	for _, post := range saved {
+		if post.Inserted {
+			counts.Inserted++
+			if feed.FetchFullContent && strings.TrimSpace(byKey[post.DedupKey].Link) != "" {
+				toExtract = append(toExtract, post.ID)
+			}
+		} else {
+			counts.Updated++
+			updated = append(updated, post.ID)
+		}
+		item := byKey[post.DedupKey]
+		base := itemBaseURL(item, rssFeed, feed)
+		for _, category := range item.Categories {
+			if category = strings.TrimSpace(category); category != "" {
+				categories.PostIds = append(categories.PostIds, post.ID)
+				categories.Names = append(categories.Names, category)
+			}
+		}
+		for _, enclosure := range item.Enclosures {
+			enclosureURL := sanitize.URL(enclosure.URL, base)
+			if enclosureURL == "" {
+				continue
+			}
+			length, _ := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+			enclosures.Ids = append(enclosures.Ids, uuid.New())
+			enclosures.PostIds = append(enclosures.PostIds, post.ID)
+			enclosures.Urls = append(enclosures.Urls, enclosureURL)
+			enclosures.Types = append(enclosures.Types, enclosure.Type)
+			enclosures.Lengths = append(enclosures.Lengths, length)
+		}
+		episode, ok := item.podcastEpisode(
+			rssFeed.Channel.ITunesImage.Href,
+			rssFeed.Channel.ITunesExplicit,
+			base,
+		)
+		if ok {
+			episodes.PostIds = append(episodes.PostIds, post.ID)
+			episodes.Durations = append(episodes.Durations, episode.DurationSeconds)
+			episodes.Episodes = append(episodes.Episodes, episode.Episode)
+			episodes.Seasons = append(episodes.Seasons, episode.Season)
+			episodes.Explicits = append(episodes.Explicits, episode.Explicit)
+			episodes.ArtworkUrls = append(episodes.ArtworkUrls, episode.ArtworkURL)
+		}
+	}
+	counts.Skipped += len(params.Ids) - len(saved)
+
+	// An updated post's categories and enclosures are replaced, so the ones
+	// the item no longer lists don't linger.
+	if len(updated) > 0 {
+		if err := qtx.DeletePostCategories(ctx, updated); err != nil {
+			return counts, err
+		}
+		if err := qtx.DeletePostEnclosures(ctx, updated); err != nil {
+			return counts, err
+		}
+	}
+	if len(categories.PostIds) > 0 {
+		if err := qtx.CreatePostCategories(ctx, categories); err != nil {
+			return counts, err
+		}
+	}
+	if len(enclosures.Ids) > 0 {
+		if err := qtx.CreatePostEnclosures(ctx, enclosures); err != nil {
+			return counts, err
+		}
+	}
+	if len(episodes.PostIds) > 0 {
+		if err := qtx.UpsertPodcastEpisodes(ctx, episodes); err != nil {
+			return counts, err
+		}
+	}
+	if len(toExtract) > 0 {
+		if err := qtx.QueuePostsForExtraction(ctx, toExtract); err != nil {
+			return counts, err
+		}
+	}
+	return counts, tx.Commit()
+}
@@ -0,0 +1,293 @@
+package scraper
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/internal/fetcher"
+	"github.com/AxterDoesCode/blogAggregator/internal/sanitize"
+)
+
+type RSSFeed struct {
+	Channel struct {
+		Title           string      `xml:"title"`
+		Link            string      `xml:"link"`
+		Description     string      `xml:"description"`
+		Language        string      `xml:"language"`
+		TTL             string      `xml:"ttl"`
+		SkipHours       []string    `xml:"skipHours>hour"`
+		SkipDays        []string    `xml:"skipDays>day"`
+		UpdatePeriod    string      `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string      `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+		ITunesImage     ITunesImage `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+		ITunesExplicit  string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+		Item            []RSSItem   `xml:"item"`
+	} `xml:"channel"`
+}
+
+type RSSItem struct {
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link"`
+	Description string         `xml:"description"`
+	PubDate     string         `xml:"pubDate"`
+	GUID        string         `xml:"guid"`
+	Author      string         `xml:"author"`
+	Creator     string         `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string       `xml:"category"`
+	Content     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Enclosures  []RSSEnclosure `xml:"enclosure"`
+	Thumbnails  []RSSThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+
+	ITunesDuration string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ITunesEpisode  string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	ITunesSeason   string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	ITunesExplicit string      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+	ITunesImage    ITunesImage `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+}
+
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type RSSThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+type ITunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// fetchResult is what a fetch learned about the feed. It is returned even when
+// the fetch fails, as the response headers still say when to come back.
+type fetchResult struct {
+	Feed         *RSSFeed
+	MaxAge       time.Duration
+	RetryAfter   time.Duration
+	PermanentURL string
+	Encoding     string
+	Repair       string
+}
+
+func (s *Scraper) scrapeFeed(ctx context.Context, feed database.Feed) (*fetchResult, error) {
+	result, err := s.fetchFeed(ctx, feed.Url)
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	recordFetchError(ctx, s.DB, feed, err)
+	if err != nil {
+		log.Printf("Couldn't fetch feed %s: %v", feed.Name, err)
+		return result, err
+	}
+	feedData := result.Feed
+	recordEncoding(ctx, s.DB, feed, result.Encoding)
+	recordParseRepair(ctx, s.DB, feed, result.Repair)
+	if result.PermanentURL != "" {
+		s.followPermanentRedirect(ctx, feed, result.PermanentURL)
+	}
+
+	counts, err := s.savePosts(ctx, feed, feedData)
+	if err != nil {
+		log.Printf("Couldn't save posts for feed %s: %v", feed.Name, err)
+		return result, err
+	}
+	log.Printf(
+		"Feed %s collected: %d new, %d updated, %d unchanged",
+		feed.Name,
+		counts.Inserted,
+		counts.Updated,
+		counts.Skipped,
+	)
+	return result, nil
+}
+
+// dedupKey identifies the item within its feed: by GUID when it has one,
+// otherwise by link, and failing both by a hash of its text.
+func (item RSSItem) dedupKey() string {
+	if guid := strings.TrimSpace(item.GUID); guid != "" {
+		return "guid:" + guid
+	}
+	return item.legacyDedupKey()
+}
+
+// legacyDedupKey is the key the item was stored under before GUIDs were kept,
+// when every post was keyed by its link or text.
+func (item RSSItem) legacyDedupKey() string {
+	if link := strings.TrimSpace(item.Link); link != "" {
+		return "link:" + link
+	}
+	sum := md5.Sum([]byte(item.Title + "\n" + item.Description))
+	return "hash:" + hex.EncodeToString(sum[:])
+}
+
+// author prefers dc:creator, as RSS's own author element is meant to be an
+// email address.
+func (item RSSItem) author() string {
+	if creator := strings.TrimSpace(item.Creator); creator != "" {
+		return creator
+	}
+	return strings.TrimSpace(item.Author)
+}
+
+func (item RSSItem) thumbnailURL(base *url.URL) string {
+	for _, thumbnail := range item.Thumbnails {
+		if thumbnailURL := sanitize.URL(thumbnail.URL, base); thumbnailURL != "" {
+			return thumbnailURL
+		}
+	}
+	return ""
+}
+
+var pubDateLayouts = []string{
+	time.RFC1123,
+	time.RFC1123Z,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+}
+
+func parsePubDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range pubDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func recordFetchError(
+	ctx context.Context,
+	db *database.Queries,
+	feed database.Feed,
+	fetchErr error,
+) {
+	lastFetchError := sql.NullString{}
+	if fetchErr != nil {
+		lastFetchError = sql.NullString{String: fetchErr.Error(), Valid: true}
+	}
+	if lastFetchError == feed.LastFetchError {
+		return
+	}
+	err := db.SetFeedFetchError(ctx, database.SetFeedFetchErrorParams{
+		ID:             feed.ID,
+		LastFetchError: lastFetchError,
+	})
+	if err != nil {
+		log.Printf("Couldn't record fetch error for feed %s: %v", feed.Name, err)
+	}
+}
+
+func recordEncoding(
+	ctx context.Context,
+	db *database.Queries,
+	feed database.Feed,
+	encoding string,
+) {
+	if feed.Encoding.Valid && feed.Encoding.String == encoding {
+		return
+	}
+	err := db.SetFeedEncoding(ctx, database.SetFeedEncodingParams{
+		ID:       feed.ID,
+		Encoding: sql.NullString{String: encoding, Valid: true},
+	})
+	if err != nil {
+		log.Printf("Couldn't record encoding for feed %s: %v", feed.Name, err)
+	}
+}
+
+func recordParseRepair(
+	ctx context.Context,
+	db *database.Queries,
+	feed database.Feed,
+	repair string,
+) {
+	lastParseRepair := sql.NullString{}
+	if repair != "" {
+		log.Printf("Feed %s needed repair: %s", feed.Name, repair)
+		lastParseRepair = sql.NullString{String: repair, Valid: true}
+	}
+	if lastParseRepair == feed.LastParseRepair {
+		return
+	}
+	err := db.SetFeedParseRepair(ctx, database.SetFeedParseRepairParams{
+		ID:              feed.ID,
+		LastParseRepair: lastParseRepair,
+	})
+	if err != nil {
+		log.Printf("Couldn't record parse repair for feed %s: %v", feed.Name, err)
+	}
+}
+
+func (s *Scraper) fetchFeed(ctx context.Context, url string) (*fetchResult, error) {
+	resp, err := s.Fetcher.Fetch(ctx, url)
+	var statusErr *fetcher.StatusError
+	if errors.As(err, &statusErr) {
+		return &fetchResult{
+			RetryAfter: parseRetryAfter(statusErr.Header.Get("Retry-After"), time.Now()),
+		}, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &fetchResult{
+		MaxAge:       parseMaxAge(resp.Header.Get("Cache-Control")),
+		RetryAfter:   parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		PermanentURL: resp.PermanentURL,
+	}
+
+	parsed, err := decodeFeed(resp.Body, resp.Header.Get("Content-Type"))
+	result.Feed = parsed.Feed
+	result.Encoding = parsed.Encoding
+	result.Repair = parsed.Repair
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// followPermanentRedirect points the feed at the URL it has permanently moved
+// to, unless that URL is already tracked as another feed or we no longer hold
+// the feed's lease. The URL is normalized like one added through the API, so
+// the unique index still catches duplicates.
+func (s *Scraper) followPermanentRedirect(ctx context.Context, feed database.Feed, url string) {
+	url, err := fetcher.NormalizeFeedURL(url)
+	if err != nil {
+		log.Printf("Feed %s moved to an invalid URL, not following it: %v", feed.Name, err)
+		return
+	}
+	if url == feed.Url {
+		return
+	}
+	updated, err := s.DB.UpdateFeedUrl(ctx, database.UpdateFeedUrlParams{
+		ID:         feed.ID,
+		Url:        url,
+		LeaseOwner: s.leaseOwner(),
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		log.Printf("Feed %s moved to %s, which is already another feed", feed.Name, url)
+		return
+	}
+	if err != nil {
+		log.Printf("Couldn't update URL of feed %s: %v", feed.Name, err)
+		return
+	}
+	if updated == 0 {
+		// The feed was edited while we fetched it, its new URL wins.
+		log.Printf("Lease on feed %s lost, not following its redirect", feed.Name)
+		return
+	}
+	log.Printf("Feed %s moved permanently from %s to %s", feed.Name, feed.Url, url)
+}
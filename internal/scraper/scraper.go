@@ -0,0 +1,206 @@
+package scraper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/internal/fetcher"
+)
+
+// Scraper runs a fixed pool of workers fed by a scheduler that polls the
+// database for feeds whose next_fetch_at has passed. A slow feed only ties up
+// its own worker, the rest keep draining the queue.
+//
+// Feeds are claimed with a lease owned by WorkerID, so several instances can
+// scrape the same database without fetching a feed twice. A lease that isn't
+// completed before it expires, because its worker crashed, is claimed again.
+type Scraper struct {
+	DB            *database.Queries
+	DBConn        *sql.DB
+	WorkerID      string
+	Workers       int
+	PollInterval  time.Duration
+	LeaseDuration time.Duration
+	Intervals     IntervalPolicy
+	Fetcher       *fetcher.Client
+}
+
+// NewWorkerID returns an identifier unique to this process, for leases.
+func NewWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8])
+}
+
+// Run scrapes until stop is closed, then returns once every worker has
+// finished the feed it's on. Feeds that were claimed but not started are
+// handed back. ctx is only for the in-flight work: cancelling it aborts
+// fetches and queries part way, and their feeds are handed back too.
+func (s *Scraper) Run(ctx context.Context, stop <-chan struct{}) {
+	log.Printf(
+		"Starting scraping as %s on %v workers, checking for due feeds every %s",
+		s.WorkerID,
+		s.Workers,
+		s.PollInterval,
+	)
+
+	queue := make(chan database.Feed, s.Workers)
+	workers := &sync.WaitGroup{}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		s.sanitizeLegacyPosts(ctx, stop)
+	}()
+	for i := 0; i < s.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.work(ctx, stop, queue)
+		}()
+	}
+
+	s.schedule(ctx, stop, queue)
+	close(queue)
+	workers.Wait()
+	log.Println("Stopped scraping")
+}
+
+func (s *Scraper) schedule(ctx context.Context, stop <-chan struct{}, queue chan<- database.Feed) {
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+
+	for !stopped(ctx, stop) {
+		// A full batch means there's a backlog, so go straight back for more;
+		// sending to the queue blocks while the workers are busy.
+		if s.enqueueDueFeeds(ctx, stop, queue) == s.Workers {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scraper) enqueueDueFeeds(
+	ctx context.Context,
+	stop <-chan struct{},
+	queue chan<- database.Feed,
+) int {
+	feeds, err := s.DB.ClaimDueFeeds(ctx, database.ClaimDueFeedsParams{
+		WorkerID:     s.leaseOwner(),
+		LeaseSeconds: s.LeaseDuration.Seconds(),
+		MaxFeeds:     int32(s.Workers),
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Couldn't claim feeds to fetch: %v", err)
+		}
+		return 0
+	}
+
+	for i, feed := range feeds {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		case queue <- feed:
+			continue
+		}
+		for _, unqueued := range feeds[i:] {
+			s.releaseLease(unqueued)
+		}
+		return i
+	}
+	return len(feeds)
+}
+
+func (s *Scraper) work(ctx context.Context, stop <-chan struct{}, queue <-chan database.Feed) {
+	for feed := range queue {
+		if stopped(ctx, stop) {
+			s.releaseLease(feed)
+			continue
+		}
+		result, err := s.scrapeFeed(ctx, feed)
+		if ctx.Err() != nil {
+			s.releaseLease(feed)
+			continue
+		}
+		s.completeLease(ctx, feed, result, err)
+	}
+}
+
+// stopped reports whether stop has been closed or ctx is done.
+func stopped(ctx context.Context, stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return ctx.Err() != nil
+	}
+}
+
+func (s *Scraper) leaseOwner() sql.NullString {
+	return sql.NullString{String: s.WorkerID, Valid: true}
+}
+
+// completeLease schedules the feed's next fetch and gives up the lease.
+func (s *Scraper) completeLease(
+	ctx context.Context,
+	feed database.Feed,
+	result *fetchResult,
+	fetchErr error,
+) {
+	overrideSeconds, err := s.DB.GetFeedPollIntervalOverride(ctx, feed.ID)
+	if err != nil {
+		log.Printf("Couldn't get poll interval override for feed %s: %v", feed.Name, err)
+	}
+	interval, delay := s.Intervals.nextFetch(
+		time.Duration(feed.FetchIntervalSeconds)*time.Second,
+		time.Duration(overrideSeconds)*time.Second,
+		result,
+		fetchErr,
+		time.Now(),
+	)
+
+	completed, err := s.DB.CompleteFeedFetch(ctx, database.CompleteFeedFetchParams{
+		FetchIntervalSeconds:  int32(interval.Seconds()),
+		NextFetchDelaySeconds: delay.Seconds(),
+		ID:                    feed.ID,
+		LeaseOwner:            s.leaseOwner(),
+	})
+	if err != nil {
+		log.Printf("Couldn't mark feed %s fetched: %v", feed.Name, err)
+		return
+	}
+	if completed == 0 {
+		log.Printf("Lease on feed %s expired before it was fetched", feed.Name)
+	}
+}
+
+// releaseLease hands an unfinished feed back so another worker can claim it
+// straight away. It runs during shutdown, possibly after the scraper's context
+// has been cancelled, so it uses its own short deadline.
+func (s *Scraper) releaseLease(feed database.Feed) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.DB.ReleaseFeedLease(ctx, database.ReleaseFeedLeaseParams{
+		ID:         feed.ID,
+		LeaseOwner: s.leaseOwner(),
+	})
+	if err != nil {
+		log.Printf("Couldn't release lease on feed %s: %v", feed.Name, err)
+	}
+}
@@ -0,0 +1,380 @@
+package apiconfig
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	httphandler "github.com/AxterDoesCode/blogAggregator/pkg/httpHandler"
+)
+
+func (cfg *ApiConfig) MiddlewareAdmin(handler authedHandler) authedHandler {
+	return func(w http.ResponseWriter, r *http.Request, user database.User) {
+		if !user.IsAdmin {
+			httphandler.RespondWithError(w, http.StatusForbidden, "Admin access required")
+			return
+		}
+		handler(w, r, user)
+	}
+}
+
+func parseUUIDParam(r *http.Request, name string) (uuid.UUID, error) {
+	return uuid.Parse(chi.URLParam(r, name))
+}
+
+// parseLimitOffset reads the limit and offset query parameters, capped to fit
+// the int32s the queries take.
+func parseLimitOffset(r *http.Request, defaultLimit int) (int, int) {
+	limit := defaultLimit
+	offset := 0
+	if specifiedLimit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil &&
+		specifiedLimit > 0 {
+		limit = specifiedLimit
+	}
+	if specifiedOffset, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil &&
+		specifiedOffset > 0 {
+		offset = specifiedOffset
+	}
+	if limit > math.MaxInt32 {
+		limit = math.MaxInt32
+	}
+	if offset > math.MaxInt32 {
+		offset = math.MaxInt32
+	}
+	return limit, offset
+}
+
+func (cfg *ApiConfig) HandleAdminListUsers(
+	w http.ResponseWriter,
+	r *http.Request,
+	admin database.User,
+) {
+	limit, offset := parseLimitOffset(r, 50)
+	users, err := cfg.DB.ListUsers(r.Context(), database.ListUsersParams{
+		Limit:  int32(limit),
+		Offset: int32(offset),
+	})
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error listing users")
+		return
+	}
+	httphandler.RespondWithJSON(w, http.StatusOK, users)
+}
+
+func (cfg *ApiConfig) HandleAdminDisableUser(
+	w http.ResponseWriter,
+	r *http.Request,
+	admin database.User,
+) {
+	cfg.setUserDisabled(w, r, admin, true)
+}
+
+func (cfg *ApiConfig) HandleAdminEnableUser(
+	w http.ResponseWriter,
+	r *http.Request,
+	admin database.User,
+) {
+	cfg.setUserDisabled(w, r, admin, false)
+}
+
+func (cfg *ApiConfig) setUserDisabled(
+	w http.ResponseWriter,
+	r *http.Request,
+	admin database.User,
+	disabled bool,
+) {
+	userID, err := parseUUIDParam(r, "userID")
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error parsing UUID")
+		return
+	}
+	if disabled && userID == admin.ID {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Can't disable your own account")
+		return
+	}
+
+	disabledAt := sql.NullTime{}
+	action := "user.enable"
+	if disabled {
+		disabledAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+		action = "user.disable"
+	}
+	user, err := cfg.DB.SetUserDisabledAt(r.Context(), database.SetUserDisabledAtParams{
+		ID:         userID,
+		DisabledAt: disabledAt,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error updating user")
+		return
+	}
+	cfg.recordAudit(r, admin, auditEvent{
+		Action:     action,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Before:     map[string]interface{}{"disabled": !disabled},
+		After:      map[string]interface{}{"disabled": disabled},
+	})
+	httphandler.RespondWithJSON(w, http.StatusOK, user)
+}
+
+// HandleAdminRefetchFeed forgets what the scraper knows about a feed and makes
+// it due straight away, taking it off any worker currently fetching it.
+func (cfg *ApiConfig) HandleAdminRefetchFeed(
+	w http.ResponseWriter,
+	r *http.Request,
+	admin database.User,
+) {
+	feedID, err := parseUUIDParam(r, "feedID")
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error parsing UUID")
+		return
+	}
+	feed, err := cfg.DB.ResetFeedFetch(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error updating feed")
+		return
+	}
+	cfg.recordAudit(r, admin, auditEvent{
+		Action:     "feed.refetch",
+		TargetType: "feed",
+		TargetID:   feed.ID,
+	})
+	httphandler.RespondWithJSON(w, http.StatusOK, feed)
+}
+
+func (cfg *ApiConfig) HandleAdminDisableFeed(
+	w http.ResponseWriter,
+	r *http.Request,
+	admin database.User,
+) {
+	cfg.setFeedDisabled(w, r, admin, true)
+}
+
+func (cfg *ApiConfig) HandleAdminEnableFeed(
+	w http.ResponseWriter,
+	r *http.Request,
+	admin database.User,
+) {
+	cfg.setFeedDisabled(w, r, admin, false)
+}
+
+func (cfg *ApiConfig) setFeedDisabled(
+	w http.ResponseWriter,
+	r *http.Request,
+	admin database.User,
+	disabled bool,
+) {
+	feedID, err := parseUUIDParam(r, "feedID")
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error parsing UUID")
+		return
+	}
+
+	disabledAt := sql.NullTime{}
+	action := "feed.enable"
+	if disabled {
+		disabledAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+		action = "feed.disable"
+	}
+	feed, err := cfg.DB.SetFeedDisabledAt(r.Context(), database.SetFeedDisabledAtParams{
+		ID:         feedID,
+		DisabledAt: disabledAt,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error updating feed")
+		return
+	}
+	cfg.recordAudit(r, admin, auditEvent{
+		Action:     action,
+		TargetType: "feed",
+		TargetID:   feed.ID,
+		Before:     map[string]interface{}{"disabled": !disabled},
+		After:      map[string]interface{}{"disabled": disabled},
+	})
+	httphandler.RespondWithJSON(w, http.StatusOK, feed)
+}
+
+// HandleAdminMergeFeeds folds the feed in the URL into another feed, moving
+// its followers and posts across before deleting it.
+func (cfg *ApiConfig) HandleAdminMergeFeeds(
+	w http.ResponseWriter,
+	r *http.Request,
+	admin database.User,
+) {
+	type requestParams struct {
+		IntoFeedID uuid.UUID `json:"into_feed_id"`
+	}
+
+	fromFeedID, err := parseUUIDParam(r, "feedID")
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error parsing UUID")
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error decoding parameters")
+		return
+	}
+	if params.IntoFeedID == fromFeedID {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Can't merge a feed into itself")
+		return
+	}
+
+	tx, err := cfg.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error merging feeds")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	fromFeed, err := qtx.GetFeed(r.Context(), fromFeedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error getting feed")
+		return
+	}
+	intoFeed, err := qtx.GetFeed(r.Context(), params.IntoFeedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Target feed not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error getting feed")
+		return
+	}
+
+	err = qtx.MoveFeedFollows(r.Context(), database.MoveFeedFollowsParams{
+		IntoFeedID: intoFeed.ID,
+		FromFeedID: fromFeed.ID,
+	})
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error moving followers")
+		return
+	}
+	err = qtx.MovePosts(r.Context(), database.MovePostsParams{
+		IntoFeedID: intoFeed.ID,
+		FromFeedID: fromFeed.ID,
+	})
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error moving posts")
+		return
+	}
+	err = qtx.DeleteFeed(r.Context(), fromFeed.ID)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error deleting feed")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error merging feeds")
+		return
+	}
+
+	cfg.recordAudit(r, admin, auditEvent{
+		Action:     "feed.merge",
+		TargetType: "feed",
+		TargetID:   intoFeed.ID,
+		Before:     feedSummary(fromFeed),
+		After:      feedSummary(intoFeed),
+	})
+	httphandler.RespondWithJSON(w, http.StatusOK, intoFeed)
+}
+
+func (cfg *ApiConfig) HandleAdminDeletePost(
+	w http.ResponseWriter,
+	r *http.Request,
+	admin database.User,
+) {
+	postID, err := parseUUIDParam(r, "postID")
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error parsing UUID")
+		return
+	}
+	post, err := cfg.DB.DeletePost(r.Context(), postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error deleting post")
+		return
+	}
+	cfg.recordAudit(r, admin, auditEvent{
+		Action:     "post.delete",
+		TargetType: "post",
+		TargetID:   post.ID,
+		Before: map[string]interface{}{
+			"feed_id": post.FeedID,
+			"title":   post.Title,
+			"url":     post.Url,
+		},
+	})
+	httphandler.RespondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+func (cfg *ApiConfig) HandleAdminGetScraperStatus(
+	w http.ResponseWriter,
+	r *http.Request,
+	admin database.User,
+) {
+	type response struct {
+		TotalFeeds        int64           `json:"total_feeds"`
+		DisabledFeeds     int64           `json:"disabled_feeds"`
+		NeverFetchedFeeds int64           `json:"never_fetched_feeds"`
+		FailingFeeds      int64           `json:"failing_feeds"`
+		LeasedFeeds       int64           `json:"leased_feeds"`
+		RecentFailures    []database.Feed `json:"recent_failures"`
+	}
+
+	status, err := cfg.DB.GetScraperStatus(r.Context())
+	if err != nil {
+		httphandler.RespondWithError(
+			w,
+			http.StatusInternalServerError,
+			"Error getting scraper status",
+		)
+		return
+	}
+	failing, err := cfg.DB.GetFailingFeeds(r.Context(), 20)
+	if err != nil {
+		httphandler.RespondWithError(
+			w,
+			http.StatusInternalServerError,
+			"Error getting failing feeds",
+		)
+		return
+	}
+	httphandler.RespondWithJSON(w, http.StatusOK, response{
+		TotalFeeds:        status.TotalFeeds,
+		DisabledFeeds:     status.DisabledFeeds,
+		NeverFetchedFeeds: status.NeverFetchedFeeds,
+		FailingFeeds:      status.FailingFeeds,
+		LeasedFeeds:       status.LeasedFeeds,
+		RecentFailures:    failing,
+	})
+}
@@ -0,0 +1,180 @@
+package apiconfig
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	httphandler "github.com/AxterDoesCode/blogAggregator/pkg/httpHandler"
+)
+
+type auditEvent struct {
+	Action     string
+	TargetType string
+	TargetID   uuid.UUID
+	Before     interface{}
+	After      interface{}
+	Details    interface{}
+}
+
+// recordAudit writes an audit log entry for an action actor has already
+// taken, so failures are logged instead of failing the request.
+func (cfg *ApiConfig) recordAudit(r *http.Request, actor database.User, event auditEvent) {
+	err := writeAudit(cfg.DB, r, actor, event)
+	if err != nil {
+		log.Printf("Couldn't record audit log entry for %s: %v", event.Action, err)
+	}
+}
+
+func writeAudit(
+	db *database.Queries,
+	r *http.Request,
+	actor database.User,
+	event auditEvent,
+) error {
+	return db.CreateAuditLogEntry(r.Context(), database.CreateAuditLogEntryParams{
+		ID:         uuid.New(),
+		CreatedAt:  time.Now().UTC(),
+		ActorID:    uuid.NullUUID{UUID: actor.ID, Valid: actor.ID != uuid.Nil},
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   uuid.NullUUID{UUID: event.TargetID, Valid: event.TargetID != uuid.Nil},
+		Details:    auditJSON(event.Action, event.Details),
+		RequestID:  middleware.GetReqID(r.Context()),
+		Ip:         clientIP(r),
+		Before:     auditJSON(event.Action, event.Before),
+		After:      auditJSON(event.Action, event.After),
+	})
+}
+
+func auditJSON(action string, v interface{}) json.RawMessage {
+	if v == nil {
+		return json.RawMessage("{}")
+	}
+	dat, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Couldn't marshal audit summary for %s: %v", action, err)
+		return json.RawMessage("{}")
+	}
+	return dat
+}
+
+func userSummary(user database.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          user.ID,
+		"name":        user.Name,
+		"preferences": user.Preferences,
+		"disabled":    user.DisabledAt.Valid,
+	}
+}
+
+func feedSummary(feed database.Feed) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       feed.ID,
+		"name":     feed.Name,
+		"url":      feed.Url,
+		"disabled": feed.DisabledAt.Valid,
+	}
+}
+
+func feedFollowSummary(feedFollow database.FeedFollow) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      feedFollow.ID,
+		"feed_id": feedFollow.FeedID,
+		"user_id": feedFollow.UserID,
+	}
+}
+
+// HandleGetAuditLog lists audit entries for admins, filterable by actor_id,
+// action, target_type, target_id, since and until.
+func (cfg *ApiConfig) HandleGetAuditLog(
+	w http.ResponseWriter,
+	r *http.Request,
+	user database.User,
+) {
+	params, err := parseAuditFilters(r)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cfg.respondWithAuditLog(w, r, params)
+}
+
+// HandleGetOwnAuditLog lists the audit entries for actions the user took.
+func (cfg *ApiConfig) HandleGetOwnAuditLog(
+	w http.ResponseWriter,
+	r *http.Request,
+	user database.User,
+) {
+	params, err := parseAuditFilters(r)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	params.ActorID = uuid.NullUUID{UUID: user.ID, Valid: true}
+	cfg.respondWithAuditLog(w, r, params)
+}
+
+func (cfg *ApiConfig) respondWithAuditLog(
+	w http.ResponseWriter,
+	r *http.Request,
+	params database.ListAuditLogParams,
+) {
+	entries, err := cfg.DB.ListAuditLog(r.Context(), params)
+	if err != nil {
+		httphandler.RespondWithError(
+			w,
+			http.StatusInternalServerError,
+			"Error getting audit log",
+		)
+		return
+	}
+	httphandler.RespondWithJSON(w, http.StatusOK, entries)
+}
+
+func parseAuditFilters(r *http.Request) (database.ListAuditLogParams, error) {
+	query := r.URL.Query()
+	limit, offset := parseLimitOffset(r, 50)
+	params := database.ListAuditLogParams{
+		RowLimit:  int32(limit),
+		RowOffset: int32(offset),
+	}
+	if action := query.Get("action"); action != "" {
+		params.Action = sql.NullString{String: action, Valid: true}
+	}
+	if targetType := query.Get("target_type"); targetType != "" {
+		params.TargetType = sql.NullString{String: targetType, Valid: true}
+	}
+	for name, dst := range map[string]*uuid.NullUUID{
+		"actor_id":  &params.ActorID,
+		"target_id": &params.TargetID,
+	} {
+		if raw := query.Get(name); raw != "" {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				return params, fmt.Errorf("Invalid %s", name)
+			}
+			*dst = uuid.NullUUID{UUID: id, Valid: true}
+		}
+	}
+	for name, dst := range map[string]*sql.NullTime{
+		"since": &params.Since,
+		"until": &params.Until,
+	} {
+		if raw := query.Get(name); raw != "" {
+			t, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return params, fmt.Errorf("Invalid %s, expected an RFC 3339 timestamp", name)
+			}
+			*dst = sql.NullTime{Time: t.UTC(), Valid: true}
+		}
+	}
+	return params, nil
+}
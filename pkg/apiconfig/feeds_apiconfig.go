@@ -0,0 +1,337 @@
+package apiconfig
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/internal/fetcher"
+	httphandler "github.com/AxterDoesCode/blogAggregator/pkg/httpHandler"
+)
+
+// DirectoryFeed is a feed as listed in the feed directory. Followed is only
+// ever true for authenticated requests.
+type DirectoryFeed struct {
+	ID            uuid.UUID  `json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Name          string     `json:"name"`
+	Url           string     `json:"url"`
+	FollowerCount int64      `json:"follower_count"`
+	LastPostAt    *time.Time `json:"last_post_at"`
+	Followed      bool       `json:"followed"`
+}
+
+// directorySorts maps the sort options to whether they sort descending by
+// default.
+var directorySorts = map[string]bool{
+	"name":      false,
+	"created":   true,
+	"followers": true,
+	"last_post": true,
+}
+
+// maxDirectoryOffset caps how deep the directory can be paged, as every page
+// sorts everything before it.
+const maxDirectoryOffset = 10000
+
+// HandleGetFeeds lists the feed directory, excluding disabled feeds. It takes
+// limit and offset, q to search names and URLs, sort (name, created,
+// followers or last_post, default followers) and order (asc or desc).
+func (cfg *ApiConfig) HandleGetFeeds(w http.ResponseWriter, r *http.Request, user *database.User) {
+	query := r.URL.Query()
+	limit, offset := parseLimitOffset(r, 50)
+	if limit > 100 {
+		limit = 100
+	}
+	if offset > maxDirectoryOffset {
+		offset = maxDirectoryOffset
+	}
+
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = "followers"
+	}
+	descending, ok := directorySorts[sort]
+	if !ok {
+		httphandler.RespondWithError(
+			w,
+			http.StatusBadRequest,
+			"sort must be name, created, followers or last_post",
+		)
+		return
+	}
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		descending = false
+	case "desc":
+		descending = true
+	default:
+		httphandler.RespondWithError(w, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+
+	params := database.ListFeedDirectoryParams{
+		Sort:       sort,
+		Descending: descending,
+		RowLimit:   int32(limit),
+		RowOffset:  int32(offset),
+	}
+	if user != nil {
+		params.UserID = uuid.NullUUID{UUID: user.ID, Valid: true}
+	}
+	if search := strings.TrimSpace(query.Get("q")); search != "" {
+		params.Search = sql.NullString{String: escapeLike(search), Valid: true}
+	}
+
+	rows, err := cfg.DB.ListFeedDirectory(r.Context(), params)
+	if err != nil {
+		httphandler.RespondWithError(
+			w,
+			http.StatusInternalServerError,
+			"Error getting feeds from database",
+		)
+		return
+	}
+	feeds := make([]DirectoryFeed, 0, len(rows))
+	for _, row := range rows {
+		feed := DirectoryFeed{
+			ID:            row.ID,
+			CreatedAt:     row.CreatedAt,
+			UpdatedAt:     row.UpdatedAt,
+			Name:          row.Name,
+			Url:           row.Url,
+			FollowerCount: row.FollowerCount,
+			Followed:      row.Followed,
+		}
+		if row.LastPostAt.Valid {
+			lastPostAt := row.LastPostAt.Time
+			feed.LastPostAt = &lastPostAt
+		}
+		feeds = append(feeds, feed)
+	}
+	httphandler.RespondWithJSON(w, http.StatusOK, feeds)
+}
+
+// escapeLike makes s match literally in an ILIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// canManageFeed reports whether user may change a feed. Feeds are shared, so
+// that's only whoever added it, or an admin.
+func canManageFeed(user database.User, feed database.Feed) bool {
+	return user.IsAdmin || (feed.CreatedBy.Valid && feed.CreatedBy.UUID == user.ID)
+}
+
+// HandleUpdateFeed renames a feed or changes its URL. A feed with a new URL
+// is fetched again from scratch.
+func (cfg *ApiConfig) HandleUpdateFeed(w http.ResponseWriter, r *http.Request, user database.User) {
+	type requestParams struct {
+		Name *string `json:"name"`
+		Url  *string `json:"url"`
+	}
+
+	feedID, err := parseUUIDParam(r, "feedID")
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error parsing UUID")
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error decoding parameters")
+		return
+	}
+	if params.Name == nil && params.Url == nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Nothing to update")
+		return
+	}
+	if params.Name != nil && strings.TrimSpace(*params.Name) == "" {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "name can't be empty")
+		return
+	}
+	feedUrl := ""
+	if params.Url != nil {
+		feedUrl, err = fetcher.NormalizeFeedURL(*params.Url)
+		if err != nil {
+			httphandler.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	tx, err := cfg.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error updating feed")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	before, err := qtx.GetFeedForUpdate(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error getting feed")
+		return
+	}
+	if !canManageFeed(user, before) {
+		httphandler.RespondWithError(
+			w,
+			http.StatusForbidden,
+			"Only the feed's creator or an admin can change this",
+		)
+		return
+	}
+
+	update := database.UpdateFeedParams{
+		ID:   before.ID,
+		Name: before.Name,
+		Url:  before.Url,
+	}
+	if params.Name != nil {
+		update.Name = strings.TrimSpace(*params.Name)
+	}
+	if params.Url != nil {
+		update.Url = feedUrl
+	}
+	feed, err := qtx.UpdateFeed(r.Context(), update)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		httphandler.RespondWithError(w, http.StatusConflict, "A feed with that url already exists")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error updating feed")
+		return
+	}
+	if feed.Url != before.Url {
+		feed, err = qtx.ResetFeedFetch(r.Context(), feed.ID)
+		if err != nil {
+			httphandler.RespondWithError(w, http.StatusInternalServerError, "Error updating feed")
+			return
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error updating feed")
+		return
+	}
+
+	cfg.recordAudit(r, user, auditEvent{
+		Action:     "feed.update",
+		TargetType: "feed",
+		TargetID:   feed.ID,
+		Before:     feedSummary(before),
+		After:      feedSummary(feed),
+	})
+	httphandler.RespondWithJSON(w, http.StatusOK, feed)
+}
+
+// HandleDeleteFeed deletes a feed along with its posts. Other users' follows
+// aren't taken away: while anyone else follows the feed, deleting it only
+// unfollows it for the caller, and is refused if they don't follow it.
+func (cfg *ApiConfig) HandleDeleteFeed(w http.ResponseWriter, r *http.Request, user database.User) {
+	type response struct {
+		Deleted    bool `json:"deleted"`
+		Unfollowed bool `json:"unfollowed"`
+	}
+
+	feedID, err := parseUUIDParam(r, "feedID")
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error parsing UUID")
+		return
+	}
+
+	tx, err := cfg.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error deleting feed")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// Locking the feed holds off new follows until we're done.
+	feed, err := qtx.GetFeedForUpdate(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error getting feed")
+		return
+	}
+	if !canManageFeed(user, feed) {
+		httphandler.RespondWithError(
+			w,
+			http.StatusForbidden,
+			"Only the feed's creator or an admin can delete it",
+		)
+		return
+	}
+	otherFollowers, err := qtx.CountOtherFeedFollowers(
+		r.Context(),
+		database.CountOtherFeedFollowersParams{FeedID: feed.ID, UserID: user.ID},
+	)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error deleting feed")
+		return
+	}
+
+	if otherFollowers > 0 {
+		feedFollow, err := qtx.DeleteFeedFollowByFeed(
+			r.Context(),
+			database.DeleteFeedFollowByFeedParams{FeedID: feed.ID, UserID: user.ID},
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			httphandler.RespondWithError(
+				w,
+				http.StatusConflict,
+				"Feed is followed by other users and can't be deleted",
+			)
+			return
+		}
+		if err != nil {
+			httphandler.RespondWithError(w, http.StatusInternalServerError, "Error unfollowing feed")
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			httphandler.RespondWithError(w, http.StatusInternalServerError, "Error unfollowing feed")
+			return
+		}
+		cfg.recordAudit(r, user, auditEvent{
+			Action:     "feed_follow.delete",
+			TargetType: "feed_follow",
+			TargetID:   feedFollow.ID,
+			Before:     feedFollowSummary(feedFollow),
+		})
+		httphandler.RespondWithJSON(w, http.StatusOK, response{Unfollowed: true})
+		return
+	}
+
+	if err = qtx.DeleteFeed(r.Context(), feed.ID); err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error deleting feed")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error deleting feed")
+		return
+	}
+	cfg.recordAudit(r, user, auditEvent{
+		Action:     "feed.delete",
+		TargetType: "feed",
+		TargetID:   feed.ID,
+		Before:     feedSummary(feed),
+	})
+	httphandler.RespondWithJSON(w, http.StatusOK, response{Deleted: true})
+}
@@ -1,16 +1,21 @@
 package apiconfig
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 
 	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/internal/fetcher"
 	httphandler "github.com/AxterDoesCode/blogAggregator/pkg/httpHandler"
 )
 
@@ -42,6 +47,12 @@ func (cfg *ApiConfig) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
 		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error creating user")
 		return
 	}
+	cfg.recordAudit(r, user, auditEvent{
+		Action:     "user.create",
+		TargetType: "user",
+		TargetID:   user.ID,
+		After:      userSummary(user),
+	})
 
 	httphandler.RespondWithJSON(w, http.StatusOK, user)
 }
@@ -70,71 +81,144 @@ func (cfg *ApiConfig) MiddlewareAuth(handler authedHandler) http.HandlerFunc {
 			)
 			return
 		}
+		if user.DisabledAt.Valid {
+			httphandler.RespondWithError(w, http.StatusForbidden, "Account is disabled")
+			return
+		}
 		handler(w, r, user)
 	}
 }
 
+type optionalAuthedHandler func(http.ResponseWriter, *http.Request, *database.User)
+
+// MiddlewareOptionalAuth authenticates the request when it carries an API key
+// and passes a nil user when it doesn't.
+func (cfg *ApiConfig) MiddlewareOptionalAuth(handler optionalAuthedHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			handler(w, r, nil)
+			return
+		}
+		cfg.MiddlewareAuth(func(w http.ResponseWriter, r *http.Request, user database.User) {
+			handler(w, r, &user)
+		})(w, r)
+	}
+}
+
+// HandleCreateFeed adds a feed and follows it. A URL that's already been added
+// is followed instead, responding 200 rather than 201 if the user already
+// followed it.
 func (cfg *ApiConfig) HandleCreateFeed(w http.ResponseWriter, r *http.Request, user database.User) {
 	type requestParams struct {
 		Name string `json:"name"`
 		Url  string `json:"url"`
 	}
 
-	type response struct {
-		Feed       database.Feed       `json:"feed"`
-		FeedFollow database.FeedFollow `json:"feed_follow"`
-	}
 	decoder := json.NewDecoder(r.Body)
 	params := requestParams{}
 	err := decoder.Decode(&params)
 	if err != nil {
-		httphandler.RespondWithError(
-			w,
-			http.StatusInternalServerError,
-			"Error decoding request body",
-		)
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error decoding request body")
 		return
 	}
-	feed, err := cfg.DB.CreateFeed(r.Context(), database.CreateFeedParams{
-		ID:        uuid.New(),
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
-		Name:      params.Name,
-		Url:       params.Url,
-		UserID:    user.ID,
-	})
+	feedUrl, err := fetcher.NormalizeFeedURL(params.Url)
 	if err != nil {
-		httphandler.RespondWithError(w, http.StatusInternalServerError, fmt.Sprintf(("%v"), err))
+		httphandler.RespondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	feedFollow, err := cfg.DB.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
-		ID:        uuid.New(),
-		FeedID:    feed.ID,
-		UserID:    user.ID,
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
-	})
+	sub, err := cfg.subscribe(r.Context(), user, params.Name, feedUrl)
+	if errors.Is(err, errFeedDisabled) {
+		httphandler.RespondWithError(w, http.StatusConflict, "Feed has been disabled")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error creating feed")
+		return
+	}
+	cfg.auditSubscription(r, user, sub)
 
-	httphandler.RespondWithJSON(w, http.StatusOK, response{
-		Feed:       feed,
-		FeedFollow: feedFollow,
-	})
+	status := http.StatusOK
+	if sub.NewFollow {
+		status = http.StatusCreated
+	}
+	httphandler.RespondWithJSON(w, status, sub.response())
 }
 
-func (cfg *ApiConfig) HandleGetFeeds(w http.ResponseWriter, r *http.Request) {
-	feeds, err := cfg.DB.GetAllFeeds(r.Context())
+// HandleSetFeedFullContent turns full article extraction on or off for a
+// feed. It changes the feed for every follower, so only whoever added the
+// feed or an admin may do it. Only posts ingested afterwards are extracted.
+func (cfg *ApiConfig) HandleSetFeedFullContent(
+	w http.ResponseWriter,
+	r *http.Request,
+	user database.User,
+) {
+	type requestParams struct {
+		Enabled *bool `json:"enabled"`
+	}
+
+	feedID, err := parseUUIDParam(r, "feedID")
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error parsing UUID")
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err = decoder.Decode(&params)
 	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error decoding parameters")
+		return
+	}
+	if params.Enabled == nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "enabled is required")
+		return
+	}
+
+	feed, err := cfg.DB.GetFeed(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error getting feed")
+		return
+	}
+	if !canManageFeed(user, feed) {
 		httphandler.RespondWithError(
 			w,
-			http.StatusInternalServerError,
-			"Error getting feeds from database",
+			http.StatusForbidden,
+			"Only the feed's creator or an admin can change this",
 		)
 		return
 	}
-	httphandler.RespondWithJSON(w, http.StatusOK, feeds)
+
+	updated, err := cfg.DB.SetFeedFetchFullContent(
+		r.Context(),
+		database.SetFeedFetchFullContentParams{
+			ID:               feed.ID,
+			FetchFullContent: *params.Enabled,
+		},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error updating feed")
+		return
+	}
+	cfg.recordAudit(r, user, auditEvent{
+		Action:     "feed.update",
+		TargetType: "feed",
+		TargetID:   updated.ID,
+		Before:     map[string]interface{}{"fetch_full_content": feed.FetchFullContent},
+		After:      map[string]interface{}{"fetch_full_content": updated.FetchFullContent},
+	})
+	httphandler.RespondWithJSON(w, http.StatusOK, updated)
 }
 
+// HandleCreateFeedFollow follows a feed by ID. Following a feed twice is fine,
+// it responds 201 for a new follow and 200 with the existing one.
 func (cfg *ApiConfig) HandleCreateFeedFollow(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -148,17 +232,57 @@ func (cfg *ApiConfig) HandleCreateFeedFollow(
 	params := requestParams{}
 	err := decoder.Decode(&params)
 	if err != nil {
-		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error decoding parameters")
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error decoding parameters")
 		return
 	}
-	feedFollow, err := cfg.DB.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
-		ID:        uuid.New(),
-		FeedID:    params.FeedID,
+	if params.FeedID == uuid.Nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "feed_id is required")
+		return
+	}
+
+	feed, err := cfg.DB.GetFeed(r.Context(), params.FeedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error getting feed")
+		return
+	}
+	if feed.DisabledAt.Valid {
+		httphandler.RespondWithError(w, http.StatusConflict, "Feed has been disabled")
+		return
+	}
+
+	newFeedFollowID := uuid.New()
+	feedFollow, err := cfg.DB.FollowFeed(r.Context(), database.FollowFeedParams{
+		ID:        newFeedFollowID,
+		FeedID:    feed.ID,
 		UserID:    user.ID,
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
 	})
-	httphandler.RespondWithJSON(w, http.StatusOK, feedFollow)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		// The feed was deleted since we looked it up.
+		httphandler.RespondWithError(w, http.StatusNotFound, "Feed not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error following feed")
+		return
+	}
+	if feedFollow.ID != newFeedFollowID {
+		httphandler.RespondWithJSON(w, http.StatusOK, feedFollow)
+		return
+	}
+	cfg.recordAudit(r, user, auditEvent{
+		Action:     "feed_follow.create",
+		TargetType: "feed_follow",
+		TargetID:   feedFollow.ID,
+		After:      feedFollowSummary(feedFollow),
+	})
+	httphandler.RespondWithJSON(w, http.StatusCreated, feedFollow)
 }
 
 func (cfg *ApiConfig) HandleDeleteFeedFollow(
@@ -172,11 +296,14 @@ func (cfg *ApiConfig) HandleDeleteFeedFollow(
 		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error parsing UUID")
 		return
 	}
-	err = cfg.DB.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{
+	feedFollow, err := cfg.DB.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{
 		ID:     feedFollowID,
 		UserID: user.ID,
 	})
-
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithJSON(w, http.StatusOK, struct{}{})
+		return
+	}
 	if err != nil {
 		httphandler.RespondWithError(
 			w,
@@ -185,9 +312,101 @@ func (cfg *ApiConfig) HandleDeleteFeedFollow(
 		)
 		return
 	}
+	cfg.recordAudit(r, user, auditEvent{
+		Action:     "feed_follow.delete",
+		TargetType: "feed_follow",
+		TargetID:   feedFollow.ID,
+		Before:     feedFollowSummary(feedFollow),
+	})
 	httphandler.RespondWithJSON(w, http.StatusOK, struct{}{})
 }
 
+// HandleUpdateFeedFollow sets how often the user wants the followed feed
+// polled, within the scraper's configured bounds. The scraper uses the
+// shortest interval any follower asks for; a null interval goes back to the
+// adaptive one.
+func (cfg *ApiConfig) HandleUpdateFeedFollow(
+	w http.ResponseWriter,
+	r *http.Request,
+	user database.User,
+) {
+	type requestParams struct {
+		PollIntervalSeconds *int32 `json:"poll_interval_seconds"`
+	}
+
+	feedFollowID, err := uuid.Parse(chi.URLParam(r, "feedFollowID"))
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error parsing UUID")
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error decoding parameters")
+		return
+	}
+
+	pollInterval := sql.NullInt32{}
+	if params.PollIntervalSeconds != nil {
+		// The scraper keeps every feed within these bounds, so anything
+		// outside them wouldn't do what was asked.
+		minSeconds := int32(cfg.MinPollInterval.Seconds())
+		maxSeconds := int32(cfg.MaxPollInterval.Seconds())
+		if *params.PollIntervalSeconds < minSeconds || *params.PollIntervalSeconds > maxSeconds {
+			httphandler.RespondWithError(
+				w,
+				http.StatusBadRequest,
+				fmt.Sprintf("poll_interval_seconds must be between %d and %d", minSeconds, maxSeconds),
+			)
+			return
+		}
+		pollInterval = sql.NullInt32{Int32: *params.PollIntervalSeconds, Valid: true}
+	}
+
+	feedFollow, err := cfg.DB.SetFeedFollowPollInterval(
+		r.Context(),
+		database.SetFeedFollowPollIntervalParams{
+			ID:                  feedFollowID,
+			UserID:              user.ID,
+			PollIntervalSeconds: pollInterval,
+		},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Feed follow not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(
+			w,
+			http.StatusInternalServerError,
+			"Error updating feed follow",
+		)
+		return
+	}
+
+	// A shorter interval shouldn't have to wait out the current schedule.
+	if pollInterval.Valid {
+		err = cfg.DB.BringForwardFeedFetch(r.Context(), database.BringForwardFeedFetchParams{
+			IntervalSeconds: float64(pollInterval.Int32),
+			ID:              feedFollow.FeedID,
+		})
+		if err != nil {
+			log.Printf("Couldn't reschedule feed %s: %v", feedFollow.FeedID, err)
+		}
+	}
+
+	cfg.recordAudit(r, user, auditEvent{
+		Action:     "feed_follow.update",
+		TargetType: "feed_follow",
+		TargetID:   feedFollow.ID,
+		After: map[string]interface{}{
+			"poll_interval_seconds": params.PollIntervalSeconds,
+		},
+	})
+	httphandler.RespondWithJSON(w, http.StatusOK, feedFollow)
+}
+
 func (cfg *ApiConfig) HandleGetFeedFollow(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -213,7 +432,7 @@ func (cfg *ApiConfig) HandleGetPosts(w http.ResponseWriter, r *http.Request, use
 		limit = specifiedLimit
 	}
 
-	posts, err := cfg.DB.GetPostByUser(r.Context(), database.GetPostByUserParams{
+	dbPosts, err := cfg.DB.GetPostsForUser(r.Context(), database.GetPostsForUserParams{
 		UserID: user.ID,
 		Limit:  int32(limit),
 	})
@@ -225,5 +444,14 @@ func (cfg *ApiConfig) HandleGetPosts(w http.ResponseWriter, r *http.Request, use
 		)
 		return
 	}
+	posts, err := cfg.postsWithDetails(r.Context(), user, dbPosts)
+	if err != nil {
+		httphandler.RespondWithError(
+			w,
+			http.StatusInternalServerError,
+			"Couldn't get posts for this user",
+		)
+		return
+	}
 	httphandler.RespondWithJSON(w, http.StatusOK, posts)
 }
@@ -0,0 +1,72 @@
+package apiconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/fetcher"
+	"github.com/AxterDoesCode/blogAggregator/internal/imageproxy"
+	"github.com/AxterDoesCode/blogAggregator/internal/sanitize"
+	httphandler "github.com/AxterDoesCode/blogAggregator/pkg/httpHandler"
+)
+
+// HandleGetImage serves an image through the image proxy. It's
+// unauthenticated as browsers load images without our API key; the signature
+// in the URL stops it being used as an open proxy.
+func (cfg *ApiConfig) HandleGetImage(w http.ResponseWriter, r *http.Request) {
+	if cfg.ImageProxy == nil {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Image proxy is disabled")
+		return
+	}
+	imageURL := r.URL.Query().Get("url")
+	if err := cfg.ImageProxy.Verify(chi.URLParam(r, "signature"), imageURL); err != nil {
+		httphandler.RespondWithError(w, http.StatusForbidden, "Invalid image signature")
+		return
+	}
+
+	img, err := cfg.ImageProxy.Get(r.Context(), imageURL)
+	if err != nil {
+		var statusErr *fetcher.StatusError
+		switch {
+		case errors.Is(err, imageproxy.ErrNotImage):
+			httphandler.RespondWithError(w, http.StatusBadGateway, "Not a supported image")
+		case errors.Is(err, fetcher.ErrTooLarge):
+			httphandler.RespondWithError(w, http.StatusBadGateway, "Image too large")
+		case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+			httphandler.RespondWithError(w, http.StatusNotFound, "Image not found")
+		default:
+			log.Printf("Couldn't proxy image %s: %v", imageURL, err)
+			httphandler.RespondWithError(w, http.StatusBadGateway, "Error fetching image")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", img.ContentType)
+	w.Header().Set(
+		"Cache-Control",
+		fmt.Sprintf("public, max-age=%d", int(cfg.ImageProxy.TTL().Seconds())),
+	)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	http.ServeContent(w, r, "", img.FetchedAt, bytes.NewReader(img.Body))
+}
+
+// proxyImages points the images in sanitized post HTML at the image proxy.
+func (cfg *ApiConfig) proxyImages(html string) string {
+	if cfg.ImageProxy == nil {
+		return html
+	}
+	return sanitize.RewriteImages(html, cfg.ImageProxy.URL)
+}
+
+func (cfg *ApiConfig) proxyImageURL(imageURL string) string {
+	if cfg.ImageProxy == nil || imageURL == "" {
+		return imageURL
+	}
+	return cfg.ImageProxy.URL(imageURL)
+}
@@ -0,0 +1,302 @@
+package apiconfig
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/internal/sanitize"
+	httphandler "github.com/AxterDoesCode/blogAggregator/pkg/httpHandler"
+)
+
+// Post is a post as the API serves it. Description and Content are sanitized
+// HTML, Excerpt is plain text. For feeds with full content fetching on,
+// ExtractionStatus goes from "pending" to "done" or "failed", and once done
+// Content is the extracted article. When the image proxy is on, image URLs
+// point at it.
+type Post struct {
+	ID               uuid.UUID       `json:"id"`
+	CreatedAt        time.Time       `json:"created_at"`
+	UpdatedAt        time.Time       `json:"updated_at"`
+	FeedID           uuid.UUID       `json:"feed_id"`
+	Guid             string          `json:"guid"`
+	Title            string          `json:"title"`
+	Url              string          `json:"url"`
+	Author           string          `json:"author"`
+	Description      string          `json:"description"`
+	Content          string          `json:"content"`
+	Excerpt          string          `json:"excerpt"`
+	ExtractionStatus string          `json:"extraction_status"`
+	ExtractionError  string          `json:"extraction_error"`
+	PublishedAt      *time.Time      `json:"published_at"`
+	ThumbnailUrl     string          `json:"thumbnail_url"`
+	Categories       []string        `json:"categories"`
+	Enclosures       []PostEnclosure `json:"enclosures"`
+	Podcast          *PodcastEpisode `json:"podcast"`
+}
+
+type PostEnclosure struct {
+	Url    string `json:"url"`
+	Type   string `json:"type"`
+	Length int64  `json:"length"`
+}
+
+// PodcastEpisode is set on posts that are podcast episodes. The audio comes
+// from the first audio or video enclosure; Playback is the requesting user's
+// position, if they've started it.
+type PodcastEpisode struct {
+	AudioUrl        string            `json:"audio_url"`
+	AudioType       string            `json:"audio_type"`
+	AudioLength     int64             `json:"audio_length"`
+	DurationSeconds *int32            `json:"duration_seconds"`
+	Episode         *int32            `json:"episode"`
+	Season          *int32            `json:"season"`
+	Explicit        bool              `json:"explicit"`
+	ArtworkUrl      string            `json:"artwork_url"`
+	Playback        *PlaybackPosition `json:"playback"`
+}
+
+type PlaybackPosition struct {
+	PostID          uuid.UUID `json:"post_id"`
+	PositionSeconds int32     `json:"position_seconds"`
+	Completed       bool      `json:"completed"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// postsWithDetails converts posts for the API, loading their categories,
+// enclosures, podcast details and the user's playback positions with one
+// query each.
+func (cfg *ApiConfig) postsWithDetails(
+	ctx context.Context,
+	user database.User,
+	dbPosts []database.Post,
+) ([]Post, error) {
+	ids := make([]uuid.UUID, 0, len(dbPosts))
+	for _, dbPost := range dbPosts {
+		ids = append(ids, dbPost.ID)
+	}
+	categories, err := cfg.DB.GetPostCategories(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	enclosures, err := cfg.DB.GetPostEnclosures(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	episodes, err := cfg.DB.GetPodcastEpisodes(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	positions, err := cfg.DB.GetPlaybackPositions(ctx, database.GetPlaybackPositionsParams{
+		UserID:  user.ID,
+		PostIds: ids,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	categoriesByPost := map[uuid.UUID][]string{}
+	for _, category := range categories {
+		categoriesByPost[category.PostID] = append(categoriesByPost[category.PostID], category.Name)
+	}
+	enclosuresByPost := map[uuid.UUID][]PostEnclosure{}
+	for _, enclosure := range enclosures {
+		enclosuresByPost[enclosure.PostID] = append(enclosuresByPost[enclosure.PostID], PostEnclosure{
+			Url:    enclosure.Url,
+			Type:   enclosure.Type,
+			Length: enclosure.Length,
+		})
+	}
+
+	episodesByPost := map[uuid.UUID]database.PodcastEpisode{}
+	for _, episode := range episodes {
+		episodesByPost[episode.PostID] = episode
+	}
+	positionsByPost := map[uuid.UUID]database.PlaybackPosition{}
+	for _, position := range positions {
+		positionsByPost[position.PostID] = position
+	}
+
+	posts := make([]Post, 0, len(dbPosts))
+	for _, dbPost := range dbPosts {
+		post := Post{
+			ID:               dbPost.ID,
+			CreatedAt:        dbPost.CreatedAt,
+			UpdatedAt:        dbPost.UpdatedAt,
+			FeedID:           dbPost.FeedID,
+			Guid:             dbPost.Guid,
+			Title:            dbPost.Title,
+			Url:              dbPost.Url,
+			Author:           dbPost.Author,
+			Description:      dbPost.Description,
+			Content:          dbPost.Content,
+			Excerpt:          dbPost.Excerpt,
+			ExtractionStatus: dbPost.ExtractionStatus,
+			ExtractionError:  dbPost.ExtractionError,
+			ThumbnailUrl:     dbPost.ThumbnailUrl,
+			Categories:       categoriesByPost[dbPost.ID],
+			Enclosures:       enclosuresByPost[dbPost.ID],
+		}
+		if !dbPost.HtmlSanitized {
+			// Stored before sanitizing at ingest and not yet backfilled.
+			base, err := url.Parse(dbPost.Url)
+			if err != nil || !base.IsAbs() {
+				base = nil
+			}
+			post.Description = sanitize.HTML(dbPost.RawDescription, base)
+			post.Content = sanitize.HTML(dbPost.RawContent, base)
+			post.Excerpt = sanitize.PostExcerpt(dbPost.RawDescription, dbPost.RawContent)
+		}
+		if dbPost.ExtractionStatus == "done" && dbPost.FullContent != "" {
+			post.Content = dbPost.FullContent
+		}
+		post.Description = cfg.proxyImages(post.Description)
+		post.Content = cfg.proxyImages(post.Content)
+		post.ThumbnailUrl = cfg.proxyImageURL(post.ThumbnailUrl)
+		if dbPost.PublishedAt.Valid {
+			publishedAt := dbPost.PublishedAt.Time
+			post.PublishedAt = &publishedAt
+		}
+		if post.Categories == nil {
+			post.Categories = []string{}
+		}
+		if post.Enclosures == nil {
+			post.Enclosures = []PostEnclosure{}
+		}
+		if episode, ok := episodesByPost[dbPost.ID]; ok {
+			post.Podcast = podcastEpisode(episode, post.Enclosures)
+			post.Podcast.ArtworkUrl = cfg.proxyImageURL(post.Podcast.ArtworkUrl)
+			if position, ok := positionsByPost[dbPost.ID]; ok {
+				playback := playbackPosition(position)
+				post.Podcast.Playback = &playback
+			}
+		}
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+func podcastEpisode(episode database.PodcastEpisode, enclosures []PostEnclosure) *PodcastEpisode {
+	podcast := &PodcastEpisode{
+		DurationSeconds: positiveOrNil(episode.DurationSeconds),
+		Episode:         positiveOrNil(episode.Episode),
+		Season:          positiveOrNil(episode.Season),
+		Explicit:        episode.Explicit,
+		ArtworkUrl:      episode.ArtworkUrl,
+	}
+	for _, enclosure := range enclosures {
+		mediaType := strings.ToLower(enclosure.Type)
+		if strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/") {
+			podcast.AudioUrl = enclosure.Url
+			podcast.AudioType = enclosure.Type
+			podcast.AudioLength = enclosure.Length
+			break
+		}
+	}
+	return podcast
+}
+
+func playbackPosition(position database.PlaybackPosition) PlaybackPosition {
+	return PlaybackPosition{
+		PostID:          position.PostID,
+		PositionSeconds: position.PositionSeconds,
+		Completed:       position.Completed,
+		UpdatedAt:       position.UpdatedAt,
+	}
+}
+
+func positiveOrNil(n int32) *int32 {
+	if n <= 0 {
+		return nil
+	}
+	return &n
+}
+
+func (cfg *ApiConfig) HandleGetPlaybackPosition(
+	w http.ResponseWriter,
+	r *http.Request,
+	user database.User,
+) {
+	postID, err := parseUUIDParam(r, "postID")
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+	position, err := cfg.DB.GetPlaybackPosition(r.Context(), database.GetPlaybackPositionParams{
+		UserID: user.ID,
+		PostID: postID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "No playback position for this post")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(
+			w,
+			http.StatusInternalServerError,
+			"Error getting playback position",
+		)
+		return
+	}
+	httphandler.RespondWithJSON(w, http.StatusOK, playbackPosition(position))
+}
+
+// HandleSetPlaybackPosition saves how far the user is through an episode. It
+// 404s unless the post has audio or video and is on a feed the user follows.
+func (cfg *ApiConfig) HandleSetPlaybackPosition(
+	w http.ResponseWriter,
+	r *http.Request,
+	user database.User,
+) {
+	postID, err := parseUUIDParam(r, "postID")
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+	type parameters struct {
+		PositionSeconds *int32 `json:"position_seconds"`
+		Completed       bool   `json:"completed"`
+	}
+	params := parameters{}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+	if params.PositionSeconds == nil || *params.PositionSeconds < 0 {
+		httphandler.RespondWithError(
+			w,
+			http.StatusBadRequest,
+			"position_seconds must be zero or more",
+		)
+		return
+	}
+
+	position, err := cfg.DB.SetPlaybackPosition(r.Context(), database.SetPlaybackPositionParams{
+		UserID:          user.ID,
+		PositionSeconds: *params.PositionSeconds,
+		Completed:       params.Completed,
+		UpdatedAt:       time.Now().UTC(),
+		PostID:          postID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		httphandler.RespondWithError(w, http.StatusNotFound, "Episode not found")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(
+			w,
+			http.StatusInternalServerError,
+			"Error saving playback position",
+		)
+		return
+	}
+	httphandler.RespondWithJSON(w, http.StatusOK, playbackPosition(position))
+}
@@ -0,0 +1,70 @@
+package apiconfig
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	httphandler "github.com/AxterDoesCode/blogAggregator/pkg/httpHandler"
+	"github.com/AxterDoesCode/blogAggregator/pkg/ratelimit"
+)
+
+// MiddlewareRateLimit limits an authenticated route group per user.
+func (cfg *ApiConfig) MiddlewareRateLimit(group string, handler authedHandler) authedHandler {
+	return func(w http.ResponseWriter, r *http.Request, user database.User) {
+		if !cfg.takeRateLimitToken(w, r, group, "user:"+user.ID.String()) {
+			return
+		}
+		handler(w, r, user)
+	}
+}
+
+// MiddlewareRateLimitIP limits an unauthenticated route group per client IP.
+func (cfg *ApiConfig) MiddlewareRateLimitIP(
+	group string,
+	handler http.HandlerFunc,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.takeRateLimitToken(w, r, group, "ip:"+clientIP(r)) {
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// takeRateLimitToken reports whether the request may proceed, responding with
+// 429 when it may not. Limiter failures let the request through.
+func (cfg *ApiConfig) takeRateLimitToken(
+	w http.ResponseWriter,
+	r *http.Request,
+	group string,
+	key string,
+) bool {
+	if cfg.RateLimiter == nil {
+		return true
+	}
+	limit, ok := cfg.RateLimits[group]
+	if !ok {
+		return true
+	}
+	res, err := cfg.RateLimiter.Allow(r.Context(), group+":"+key, limit)
+	if err != nil {
+		log.Printf("Couldn't check rate limit for %s: %v", group, err)
+		return true
+	}
+	ratelimit.SetHeaders(w, res)
+	if !res.Allowed {
+		httphandler.RespondWithError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+		return false
+	}
+	return true
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,158 @@
+package apiconfig
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/internal/fetcher"
+	httphandler "github.com/AxterDoesCode/blogAggregator/pkg/httpHandler"
+)
+
+var errFeedDisabled = errors.New("feed has been disabled")
+
+// subscription is the outcome of subscribing to a feed by URL. NewFeed and
+// NewFollow say whether the feed and the follow were created by it.
+type subscription struct {
+	Feed       database.Feed
+	FeedFollow database.FeedFollow
+	NewFeed    bool
+	NewFollow  bool
+}
+
+func (sub subscription) response() interface{} {
+	return struct {
+		Feed       database.Feed       `json:"feed"`
+		FeedFollow database.FeedFollow `json:"feed_follow"`
+	}{
+		Feed:       sub.Feed,
+		FeedFollow: sub.FeedFollow,
+	}
+}
+
+// HandleSubscribe follows the feed at a URL, adding the feed first if nobody
+// has yet. Subscribing twice is fine: it responds 201 for a new follow and
+// 200 when the user already follows the feed.
+func (cfg *ApiConfig) HandleSubscribe(w http.ResponseWriter, r *http.Request, user database.User) {
+	type requestParams struct {
+		Url  string `json:"url"`
+		Name string `json:"name"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := requestParams{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Error decoding parameters")
+		return
+	}
+	feedUrl, err := fetcher.NormalizeFeedURL(params.Url)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sub, err := cfg.subscribe(r.Context(), user, params.Name, feedUrl)
+	if errors.Is(err, errFeedDisabled) {
+		httphandler.RespondWithError(w, http.StatusConflict, "Feed has been disabled")
+		return
+	}
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error subscribing to feed")
+		return
+	}
+	cfg.auditSubscription(r, user, sub)
+
+	status := http.StatusOK
+	if sub.NewFollow {
+		status = http.StatusCreated
+	}
+	httphandler.RespondWithJSON(w, status, sub.response())
+}
+
+// subscribe finds or creates the feed at feedUrl and makes sure user follows
+// it. Feeds are shared, so a URL that already exists keeps its name; a new
+// feed without one is named after its host until someone renames it.
+func (cfg *ApiConfig) subscribe(
+	ctx context.Context,
+	user database.User,
+	name string,
+	feedUrl string,
+) (subscription, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		u, _ := url.Parse(feedUrl)
+		name = u.Hostname()
+	}
+
+	tx, err := cfg.DBConn.BeginTx(ctx, nil)
+	if err != nil {
+		return subscription{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// The returned rows only carry our new IDs when they were inserted.
+	newFeedID := uuid.New()
+	feed, err := qtx.FindOrCreateFeed(ctx, database.FindOrCreateFeedParams{
+		ID:        newFeedID,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		Name:      name,
+		Url:       feedUrl,
+		CreatedBy: uuid.NullUUID{UUID: user.ID, Valid: true},
+	})
+	if err != nil {
+		return subscription{}, err
+	}
+	if feed.DisabledAt.Valid {
+		return subscription{}, errFeedDisabled
+	}
+
+	newFeedFollowID := uuid.New()
+	feedFollow, err := qtx.FollowFeed(ctx, database.FollowFeedParams{
+		ID:        newFeedFollowID,
+		FeedID:    feed.ID,
+		UserID:    user.ID,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return subscription{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return subscription{}, err
+	}
+	return subscription{
+		Feed:       feed,
+		FeedFollow: feedFollow,
+		NewFeed:    feed.ID == newFeedID,
+		NewFollow:  feedFollow.ID == newFeedFollowID,
+	}, nil
+}
+
+func (cfg *ApiConfig) auditSubscription(r *http.Request, user database.User, sub subscription) {
+	if sub.NewFeed {
+		cfg.recordAudit(r, user, auditEvent{
+			Action:     "feed.create",
+			TargetType: "feed",
+			TargetID:   sub.Feed.ID,
+			After:      feedSummary(sub.Feed),
+		})
+	}
+	if sub.NewFollow {
+		cfg.recordAudit(r, user, auditEvent{
+			Action:     "feed_follow.create",
+			TargetType: "feed_follow",
+			TargetID:   sub.FeedFollow.ID,
+			After:      feedFollowSummary(sub.FeedFollow),
+		})
+	}
+}
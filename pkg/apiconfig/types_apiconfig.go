@@ -1,7 +1,24 @@
 package apiconfig
 
-import "github.com/AxterDoesCode/blogAggregator/internal/database"
+import (
+	"database/sql"
+	"time"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	"github.com/AxterDoesCode/blogAggregator/internal/imageproxy"
+	"github.com/AxterDoesCode/blogAggregator/pkg/ratelimit"
+)
 
 type ApiConfig struct {
-	DB *database.Queries
+	DB          *database.Queries
+	DBConn      *sql.DB
+	RateLimiter ratelimit.Limiter
+	RateLimits  map[string]ratelimit.Limit
+	// ImageProxy is nil when the image proxy is off, and post images are
+	// then served with their original URLs.
+	ImageProxy *imageproxy.Proxy
+	// MinPollInterval and MaxPollInterval bound the poll intervals users can
+	// ask for, matching the scraper's.
+	MinPollInterval time.Duration
+	MaxPollInterval time.Duration
 }
@@ -0,0 +1,265 @@
+package apiconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+	httphandler "github.com/AxterDoesCode/blogAggregator/pkg/httpHandler"
+)
+
+func (cfg *ApiConfig) HandleUpdateUser(w http.ResponseWriter, r *http.Request, user database.User) {
+	type requestBody struct {
+		Name        *string         `json:"name"`
+		Preferences json.RawMessage `json:"preferences"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := requestBody{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusBadRequest, "Couldn't decode parameters")
+		return
+	}
+
+	name := user.Name
+	if params.Name != nil {
+		if *params.Name == "" {
+			httphandler.RespondWithError(w, http.StatusBadRequest, "Name can't be empty")
+			return
+		}
+		name = *params.Name
+	}
+
+	preferences := user.Preferences
+	if len(params.Preferences) > 0 {
+		preferences, err = mergePreferences(user.Preferences, params.Preferences)
+		if err != nil {
+			httphandler.RespondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	updatedUser, err := cfg.DB.UpdateUser(r.Context(), database.UpdateUserParams{
+		ID:          user.ID,
+		Name:        name,
+		Preferences: preferences,
+	})
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error updating user")
+		return
+	}
+	cfg.recordAudit(r, user, auditEvent{
+		Action:     "user.update",
+		TargetType: "user",
+		TargetID:   user.ID,
+		Before:     userSummary(user),
+		After:      userSummary(updatedUser),
+	})
+	httphandler.RespondWithJSON(w, http.StatusOK, updatedUser)
+}
+
+// mergePreferences applies patch to the stored preferences object. Top level
+// keys set to null in the patch are removed.
+func mergePreferences(current json.RawMessage, patch json.RawMessage) (json.RawMessage, error) {
+	merged := map[string]json.RawMessage{}
+	if len(current) > 0 {
+		if err := json.Unmarshal(current, &merged); err != nil {
+			return nil, fmt.Errorf("Stored preferences are invalid")
+		}
+	}
+	changes := map[string]json.RawMessage{}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("Preferences must be a JSON object")
+	}
+	for key, value := range changes {
+		if bytes.Equal(value, []byte("null")) {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = value
+	}
+	return json.Marshal(merged)
+}
+
+func (cfg *ApiConfig) HandleDeleteUser(w http.ResponseWriter, r *http.Request, user database.User) {
+	tx, err := cfg.DBConn.BeginTx(r.Context(), nil)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error deleting user")
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.DB.WithTx(tx)
+
+	// The entry has to be written while the user still exists; deleting them
+	// then clears its actor but the target keeps the user's id.
+	err = writeAudit(qtx, r, user, auditEvent{
+		Action:     "user.delete",
+		TargetType: "user",
+		TargetID:   user.ID,
+		Before:     userSummary(user),
+	})
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error deleting user")
+		return
+	}
+
+	// Follows go with the user. Feeds they created stay, as other people may
+	// follow them, and are collected later if nobody does.
+	err = qtx.DeleteUser(r.Context(), user.ID)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error deleting user")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error deleting user")
+		return
+	}
+	httphandler.RespondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// HandleExportUser downloads everything stored about the user: their account,
+// the feeds they added and follow, their playback positions and the audit log
+// entries for what they did.
+func (cfg *ApiConfig) HandleExportUser(w http.ResponseWriter, r *http.Request, user database.User) {
+	type exportedUser struct {
+		ID          uuid.UUID       `json:"id"`
+		CreatedAt   time.Time       `json:"created_at"`
+		UpdatedAt   time.Time       `json:"updated_at"`
+		Name        string          `json:"name"`
+		Preferences json.RawMessage `json:"preferences"`
+	}
+	type exportedFeed struct {
+		ID        uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		Name      string    `json:"name"`
+		Url       string    `json:"url"`
+	}
+	type exportedFeedFollow struct {
+		ID        uuid.UUID `json:"id"`
+		CreatedAt time.Time `json:"created_at"`
+		FeedID    uuid.UUID `json:"feed_id"`
+		FeedName  string    `json:"feed_name"`
+		FeedUrl   string    `json:"feed_url"`
+	}
+	type exportedPlaybackPosition struct {
+		PostID          uuid.UUID `json:"post_id"`
+		PostTitle       string    `json:"post_title"`
+		PostUrl         string    `json:"post_url"`
+		PositionSeconds int32     `json:"position_seconds"`
+		Completed       bool      `json:"completed"`
+		UpdatedAt       time.Time `json:"updated_at"`
+	}
+	type exportedAuditEntry struct {
+		ID         uuid.UUID       `json:"id"`
+		CreatedAt  time.Time       `json:"created_at"`
+		Action     string          `json:"action"`
+		TargetType string          `json:"target_type"`
+		TargetID   uuid.NullUUID   `json:"target_id"`
+		Details    json.RawMessage `json:"details"`
+		Ip         string          `json:"ip"`
+		Before     json.RawMessage `json:"before"`
+		After      json.RawMessage `json:"after"`
+	}
+	type exportArchive struct {
+		ExportedAt        time.Time                  `json:"exported_at"`
+		User              exportedUser               `json:"user"`
+		FeedsCreated      []exportedFeed             `json:"feeds_created"`
+		FeedFollows       []exportedFeedFollow       `json:"feed_follows"`
+		PlaybackPositions []exportedPlaybackPosition `json:"playback_positions"`
+		AuditLog          []exportedAuditEntry       `json:"audit_log"`
+	}
+
+	feeds, err := cfg.DB.GetFeedsByUser(r.Context(), uuid.NullUUID{UUID: user.ID, Valid: true})
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error getting feeds")
+		return
+	}
+	feedFollows, err := cfg.DB.GetFeedFollowsWithFeeds(r.Context(), user.ID)
+	if err != nil {
+		httphandler.RespondWithError(
+			w,
+			http.StatusInternalServerError,
+			"Error getting feed follows",
+		)
+		return
+	}
+	positions, err := cfg.DB.GetPlaybackPositionsByUser(r.Context(), user.ID)
+	if err != nil {
+		httphandler.RespondWithError(
+			w,
+			http.StatusInternalServerError,
+			"Error getting playback positions",
+		)
+		return
+	}
+	auditEntries, err := cfg.DB.ListAuditLogByActor(
+		r.Context(),
+		uuid.NullUUID{UUID: user.ID, Valid: true},
+	)
+	if err != nil {
+		httphandler.RespondWithError(w, http.StatusInternalServerError, "Error getting audit log")
+		return
+	}
+
+	archive := exportArchive{
+		ExportedAt: time.Now().UTC(),
+		User: exportedUser{
+			ID:          user.ID,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+			Name:        user.Name,
+			Preferences: user.Preferences,
+		},
+		FeedsCreated:      make([]exportedFeed, 0, len(feeds)),
+		FeedFollows:       make([]exportedFeedFollow, 0, len(feedFollows)),
+		PlaybackPositions: make([]exportedPlaybackPosition, 0, len(positions)),
+		AuditLog:          make([]exportedAuditEntry, 0, len(auditEntries)),
+	}
+	for _, feed := range feeds {
+		archive.FeedsCreated = append(archive.FeedsCreated, exportedFeed{
+			ID:        feed.ID,
+			CreatedAt: feed.CreatedAt,
+			Name:      feed.Name,
+			Url:       feed.Url,
+		})
+	}
+	for _, feedFollow := range feedFollows {
+		archive.FeedFollows = append(archive.FeedFollows, exportedFeedFollow{
+			ID:        feedFollow.ID,
+			CreatedAt: feedFollow.CreatedAt,
+			FeedID:    feedFollow.FeedID,
+			FeedName:  feedFollow.FeedName,
+			FeedUrl:   feedFollow.FeedUrl,
+		})
+	}
+	for _, position := range positions {
+		archive.PlaybackPositions = append(
+			archive.PlaybackPositions,
+			exportedPlaybackPosition(position),
+		)
+	}
+	for _, entry := range auditEntries {
+		archive.AuditLog = append(archive.AuditLog, exportedAuditEntry{
+			ID:         entry.ID,
+			CreatedAt:  entry.CreatedAt,
+			Action:     entry.Action,
+			TargetType: entry.TargetType,
+			TargetID:   entry.TargetID,
+			Details:    entry.Details,
+			Ip:         entry.Ip,
+			Before:     entry.Before,
+			After:      entry.After,
+		})
+	}
+
+	w.Header().Set(
+		"Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"blogaggregator-export-%s.json\"", user.ID),
+	)
+	httphandler.RespondWithJSON(w, http.StatusOK, archive)
+}
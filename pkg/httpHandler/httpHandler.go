@@ -42,3 +42,13 @@ func Readiness(w http.ResponseWriter, r *http.Request) {
 func ErrHandler(w http.ResponseWriter, r *http.Request) {
 	RespondWithError(w, 500, "Internal Server Error")
 }
+
+// MaxBodyBytes caps the size of request bodies, reads past n fail.
+func MaxBodyBytes(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/AxterDoesCode/blogAggregator/internal/database"
+)
+
+const postgresSweepInterval = 10 * time.Minute
+
+// PostgresLimiter stores buckets in the rate_limit_buckets table so that
+// every API instance shares the same limits.
+type PostgresLimiter struct {
+	DB *database.Queries
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func NewPostgresLimiter(db *database.Queries) *PostgresLimiter {
+	return &PostgresLimiter{
+		DB:        db,
+		lastSweep: time.Now(),
+	}
+}
+
+func (p *PostgresLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	p.sweep(ctx)
+	row, err := p.DB.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: float64(limit.Burst),
+		Rate:  limit.Rate,
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return newResult(limit, row.Tokens, row.Allowed), nil
+}
+
+func (p *PostgresLimiter) sweep(ctx context.Context) {
+	p.mu.Lock()
+	if time.Since(p.lastSweep) < postgresSweepInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastSweep = time.Now()
+	p.mu.Unlock()
+
+	err := p.DB.DeleteStaleRateLimitBuckets(ctx)
+	if err != nil {
+		log.Printf("Couldn't delete stale rate limit buckets: %v", err)
+	}
+}
@@ -0,0 +1,33 @@
+-- name: CreateAuditLogEntry :exec
+INSERT INTO audit_log (
+  id, created_at, actor_id, action, target_type, target_id, details, request_id, ip, before, after
+)
+VALUES (
+  $1,
+  $2,
+  $3,
+  $4,
+  $5,
+  $6,
+  $7,
+  $8,
+  $9,
+  $10,
+  $11
+  );
+
+-- name: ListAuditLog :many
+SELECT * FROM audit_log
+WHERE (sqlc.narg(actor_id)::uuid IS NULL OR actor_id = sqlc.narg(actor_id))
+AND (sqlc.narg(action)::text IS NULL OR action = sqlc.narg(action))
+AND (sqlc.narg(target_type)::text IS NULL OR target_type = sqlc.narg(target_type))
+AND (sqlc.narg(target_id)::uuid IS NULL OR target_id = sqlc.narg(target_id))
+AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since))
+AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until))
+ORDER BY created_at DESC
+LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset);
+
+-- name: ListAuditLogByActor :many
+SELECT * FROM audit_log
+WHERE actor_id = $1
+ORDER BY created_at ASC;
@@ -1,4 +1,25 @@
--- name: CreateFeedFollow :one
+-- name: DeleteFeedFollow :one
+DELETE FROM feed_follows WHERE id = $1 and user_id = $2
+RETURNING *;
+
+-- name: DeleteFeedFollowByFeed :one
+DELETE FROM feed_follows WHERE feed_id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: CountOtherFeedFollowers :one
+SELECT COUNT(*) FROM feed_follows
+WHERE feed_id = $1 AND user_id <> $2;
+
+-- name: GetFeedFollows :many
+SELECT * FROM feed_follows WHERE user_id = $1;
+
+-- name: GetFeedFollowsWithFeeds :many
+SELECT feed_follows.*, feeds.name AS feed_name, feeds.url AS feed_url FROM feed_follows
+JOIN feeds ON feeds.id = feed_follows.feed_id
+WHERE feed_follows.user_id = $1
+ORDER BY feed_follows.created_at ASC;
+
+-- name: FollowFeed :one
 INSERT INTO feed_follows (id, feed_id, user_id, created_at, updated_at)
 VALUES (
   $1,
@@ -7,10 +28,18 @@ VALUES (
   $4,
   $5
   )
+ON CONFLICT (feed_id, user_id) DO UPDATE
+SET updated_at = feed_follows.updated_at
 RETURNING *;
--- name: DeleteFeedFollow :exec
-DELETE FROM feed_follows WHERE id = $1 and user_id = $2;
 
--- name: GetFeedFollows :many
-SELECT * FROM feed_follows WHERE user_id = $1;
+-- name: SetFeedFollowPollInterval :one
+UPDATE feed_follows
+SET poll_interval_seconds = $3,
+updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
 
+-- name: GetFeedPollIntervalOverride :one
+SELECT COALESCE(MIN(poll_interval_seconds), 0)::integer AS poll_interval_seconds
+FROM feed_follows
+WHERE feed_id = $1;
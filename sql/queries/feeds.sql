@@ -1,5 +1,5 @@
--- name: CreateFeed :one
-INSERT INTO feeds (id, created_at, updated_at, name, url, user_id)
+-- name: FindOrCreateFeed :one
+INSERT INTO feeds (id, created_at, updated_at, name, url, created_by)
 VALUES (
   $1,
   $2,
@@ -8,19 +8,227 @@ VALUES (
   $5,
   $6
   )
+ON CONFLICT (url) DO UPDATE
+SET orphaned_at = NULL
 RETURNING *;
 
--- name: GetAllFeeds :many
-SELECT * FROM feeds;
+-- name: ListFeedDirectory :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url,
+(
+  SELECT COUNT(*) FROM feed_follows WHERE feed_follows.feed_id = feeds.id
+) AS follower_count,
+(
+  SELECT posts.published_at FROM posts
+  WHERE posts.feed_id = feeds.id
+  ORDER BY posts.published_at DESC NULLS LAST
+  LIMIT 1
+) AS last_post_at,
+EXISTS (
+  SELECT 1 FROM feed_follows
+  WHERE feed_follows.feed_id = feeds.id
+  AND feed_follows.user_id = sqlc.narg(user_id)
+) AS followed
+FROM (
+  SELECT sorted.* FROM (
+    SELECT feeds.id,
+    CASE WHEN sqlc.arg(sort)::text = 'name' THEN lower(feeds.name) END AS name_key,
+    CASE WHEN sqlc.arg(sort)::text = 'created' THEN feeds.created_at END AS created_key,
+    CASE WHEN sqlc.arg(sort)::text = 'followers' THEN (
+      SELECT COUNT(*) FROM feed_follows WHERE feed_follows.feed_id = feeds.id
+    ) END AS followers_key,
+    CASE WHEN sqlc.arg(sort)::text = 'last_post' THEN (
+      SELECT posts.published_at FROM posts
+      WHERE posts.feed_id = feeds.id
+      ORDER BY posts.published_at DESC NULLS LAST
+      LIMIT 1
+    ) END AS last_post_key
+    FROM feeds
+    WHERE feeds.disabled_at IS NULL
+    AND (
+      sqlc.narg(search)::text IS NULL
+      OR feeds.name ILIKE '%' || sqlc.narg(search) || '%'
+      OR feeds.url ILIKE '%' || sqlc.narg(search) || '%'
+    )
+  ) AS sorted
+  ORDER BY
+    CASE WHEN NOT sqlc.arg(descending)::bool THEN sorted.name_key END ASC,
+    CASE WHEN sqlc.arg(descending)::bool THEN sorted.name_key END DESC,
+    CASE WHEN NOT sqlc.arg(descending)::bool THEN sorted.created_key END ASC,
+    CASE WHEN sqlc.arg(descending)::bool THEN sorted.created_key END DESC,
+    CASE WHEN NOT sqlc.arg(descending)::bool THEN sorted.followers_key END ASC,
+    CASE WHEN sqlc.arg(descending)::bool THEN sorted.followers_key END DESC,
+    CASE WHEN NOT sqlc.arg(descending)::bool THEN sorted.last_post_key END ASC NULLS LAST,
+    CASE WHEN sqlc.arg(descending)::bool THEN sorted.last_post_key END DESC NULLS LAST,
+    sorted.id
+  LIMIT sqlc.arg(row_limit) OFFSET sqlc.arg(row_offset)
+) AS page
+JOIN feeds ON feeds.id = page.id
+ORDER BY
+  CASE WHEN NOT sqlc.arg(descending)::bool THEN page.name_key END ASC,
+  CASE WHEN sqlc.arg(descending)::bool THEN page.name_key END DESC,
+  CASE WHEN NOT sqlc.arg(descending)::bool THEN page.created_key END ASC,
+  CASE WHEN sqlc.arg(descending)::bool THEN page.created_key END DESC,
+  CASE WHEN NOT sqlc.arg(descending)::bool THEN page.followers_key END ASC,
+  CASE WHEN sqlc.arg(descending)::bool THEN page.followers_key END DESC,
+  CASE WHEN NOT sqlc.arg(descending)::bool THEN page.last_post_key END ASC NULLS LAST,
+  CASE WHEN sqlc.arg(descending)::bool THEN page.last_post_key END DESC NULLS LAST,
+  page.id;
 
--- name: GetNextFeedsToFetch :many
-SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT $1;
--- name: MarkFeedFetched :many
+-- name: ClaimDueFeeds :many
+UPDATE feeds
+SET lease_owner = @worker_id,
+lease_expires_at = NOW() + @lease_seconds::float8 * INTERVAL '1 second'
+WHERE id IN (
+  SELECT id FROM feeds
+  WHERE disabled_at IS NULL
+  AND (next_fetch_at IS NULL OR next_fetch_at <= NOW())
+  AND (lease_expires_at IS NULL OR lease_expires_at <= NOW())
+  AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id)
+  ORDER BY next_fetch_at ASC NULLS FIRST
+  LIMIT @max_feeds
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteFeedFetch :execrows
 UPDATE feeds
 SET last_fetched_at = NOW(),
+fetch_interval_seconds = @fetch_interval_seconds,
+next_fetch_at = NOW() + @next_fetch_delay_seconds::float8 * INTERVAL '1 second',
+lease_owner = NULL,
+lease_expires_at = NULL,
+updated_at = NOW()
+WHERE id = @id AND lease_owner = @lease_owner;
+
+-- name: ReleaseFeedLease :exec
+UPDATE feeds
+SET lease_owner = NULL,
+lease_expires_at = NULL
+WHERE id = $1 AND lease_owner = $2;
+
+-- name: GetFeedsByUser :many
+SELECT * FROM feeds WHERE created_by = $1
+ORDER BY created_at ASC;
+
+-- name: MarkOrphanedFeeds :exec
+UPDATE feeds
+SET orphaned_at = $1
+WHERE orphaned_at IS NULL
+AND NOT EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id);
+
+-- name: ClearOrphanedFeeds :exec
+UPDATE feeds
+SET orphaned_at = NULL
+WHERE orphaned_at IS NOT NULL
+AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id);
+
+-- name: DeleteOrphanedFeeds :execrows
+DELETE FROM feeds
+WHERE orphaned_at < $1
+AND NOT EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id);
+
+-- name: GetFeed :one
+SELECT * FROM feeds WHERE id = $1;
+
+-- name: GetFeedForUpdate :one
+SELECT * FROM feeds WHERE id = $1
+FOR UPDATE;
+
+-- name: UpdateFeed :one
+UPDATE feeds
+SET name = $2,
+url = $3,
+updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ResetFeedFetch :one
+UPDATE feeds
+SET last_fetched_at = NULL,
+next_fetch_at = NULL,
+fetch_interval_seconds = DEFAULT,
+last_fetch_error = NULL,
+encoding = NULL,
+last_parse_repair = NULL,
+lease_owner = NULL,
+lease_expires_at = NULL,
+updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetFeedFetchError :exec
+UPDATE feeds
+SET last_fetch_error = $2
+WHERE id = $1;
+
+-- name: SetFeedDisabledAt :one
+UPDATE feeds
+SET disabled_at = $2,
 updated_at = NOW()
 WHERE id = $1
 RETURNING *;
 
+-- name: MoveFeedFollows :exec
+INSERT INTO feed_follows (id, feed_id, user_id, created_at, updated_at, poll_interval_seconds)
+SELECT gen_random_uuid(), @into_feed_id::uuid, user_id, created_at, NOW(), poll_interval_seconds
+FROM feed_follows
+WHERE feed_id = @from_feed_id::uuid
+ON CONFLICT (feed_id, user_id) DO UPDATE
+SET poll_interval_seconds = LEAST(feed_follows.poll_interval_seconds, EXCLUDED.poll_interval_seconds),
+updated_at = EXCLUDED.updated_at
+WHERE LEAST(feed_follows.poll_interval_seconds, EXCLUDED.poll_interval_seconds)
+IS DISTINCT FROM feed_follows.poll_interval_seconds;
+
+-- name: DeleteFeed :exec
+DELETE FROM feeds WHERE id = $1;
+
+-- name: GetScraperStatus :one
+SELECT
+  COUNT(*) AS total_feeds,
+  COUNT(*) FILTER (WHERE disabled_at IS NOT NULL) AS disabled_feeds,
+  COUNT(*) FILTER (WHERE last_fetched_at IS NULL) AS never_fetched_feeds,
+  COUNT(*) FILTER (WHERE last_fetch_error IS NOT NULL) AS failing_feeds,
+  COUNT(*) FILTER (WHERE lease_expires_at > NOW()) AS leased_feeds
+FROM feeds;
+
+-- name: GetFailingFeeds :many
+SELECT * FROM feeds
+WHERE last_fetch_error IS NOT NULL
+ORDER BY last_fetched_at DESC
+LIMIT $1;
+
+-- name: BringForwardFeedFetch :exec
+UPDATE feeds
+SET next_fetch_at = LEAST(
+  COALESCE(next_fetch_at, NOW()),
+  COALESCE(last_fetched_at, NOW()) + @interval_seconds::float8 * INTERVAL '1 second'
+)
+WHERE id = @id;
+
+-- name: UpdateFeedUrl :execrows
+UPDATE feeds
+SET url = $2,
+updated_at = NOW()
+WHERE id = $1 AND lease_owner = $3;
+
+-- name: LockLeasedFeed :one
+SELECT id FROM feeds
+WHERE id = $1 AND lease_owner = $2
+FOR SHARE;
+
+-- name: SetFeedEncoding :exec
+UPDATE feeds
+SET encoding = $2
+WHERE id = $1;
+
+-- name: SetFeedParseRepair :exec
+UPDATE feeds
+SET last_parse_repair = $2
+WHERE id = $1;
+
+-- name: SetFeedFetchFullContent :one
+UPDATE feeds
+SET fetch_full_content = $2,
+updated_at = NOW()
+WHERE id = $1
+RETURNING *;
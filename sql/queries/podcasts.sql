@@ -0,0 +1,66 @@
+-- name: UpsertPodcastEpisodes :exec
+INSERT INTO podcast_episodes (post_id, duration_seconds, episode, season, explicit, artwork_url)
+SELECT
+  episode.post_id,
+  episode.duration_seconds,
+  episode.episode,
+  episode.season,
+  episode.explicit,
+  episode.artwork_url
+FROM unnest(
+  @post_ids::uuid[],
+  @durations::integer[],
+  @episodes::integer[],
+  @seasons::integer[],
+  @explicits::boolean[],
+  @artwork_urls::text[]
+) AS episode(post_id, duration_seconds, episode, season, explicit, artwork_url)
+ON CONFLICT (post_id) DO UPDATE
+SET duration_seconds = EXCLUDED.duration_seconds,
+episode = EXCLUDED.episode,
+season = EXCLUDED.season,
+explicit = EXCLUDED.explicit,
+artwork_url = EXCLUDED.artwork_url;
+
+-- name: GetPodcastEpisodes :many
+SELECT * FROM podcast_episodes
+WHERE post_id = ANY(@post_ids::uuid[]);
+
+-- name: SetPlaybackPosition :one
+INSERT INTO playback_positions (user_id, post_id, position_seconds, completed, updated_at)
+SELECT @user_id::uuid, posts.id, @position_seconds::integer, @completed::boolean, @updated_at::timestamp
+FROM posts
+WHERE posts.id = @post_id
+AND EXISTS (
+  SELECT 1 FROM feed_follows
+  WHERE feed_follows.feed_id = posts.feed_id AND feed_follows.user_id = @user_id::uuid
+)
+AND (
+  EXISTS (SELECT 1 FROM podcast_episodes WHERE podcast_episodes.post_id = posts.id)
+  OR EXISTS (
+    SELECT 1 FROM post_enclosures
+    WHERE post_enclosures.post_id = posts.id
+    AND (post_enclosures.type LIKE 'audio/%' OR post_enclosures.type LIKE 'video/%')
+  )
+)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET position_seconds = EXCLUDED.position_seconds,
+completed = EXCLUDED.completed,
+updated_at = EXCLUDED.updated_at
+RETURNING *;
+
+-- name: GetPlaybackPosition :one
+SELECT * FROM playback_positions
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: GetPlaybackPositions :many
+SELECT * FROM playback_positions
+WHERE user_id = @user_id AND post_id = ANY(@post_ids::uuid[]);
+
+-- name: GetPlaybackPositionsByUser :many
+SELECT playback_positions.post_id, posts.title AS post_title, posts.url AS post_url,
+playback_positions.position_seconds, playback_positions.completed, playback_positions.updated_at
+FROM playback_positions
+JOIN posts ON posts.id = playback_positions.post_id
+WHERE playback_positions.user_id = $1
+ORDER BY playback_positions.updated_at DESC;
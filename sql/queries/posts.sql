@@ -1,19 +1,208 @@
--- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
-VALUES (
-  $1,
-  $2,
-  $3,
-  $4,
-  $5,
-  $6,
-  $7,
-  $8
-  )
-RETURNING *;
--- name: GetPostByUser :one
-SELECT * FROM posts
+-- name: UpsertPosts :many
+INSERT INTO posts (
+  id,
+  created_at,
+  updated_at,
+  title,
+  url,
+  description,
+  published_at,
+  feed_id,
+  guid,
+  author,
+  content,
+  thumbnail_url,
+  dedup_key,
+  raw_description,
+  raw_content,
+  excerpt
+)
+SELECT
+  item.id,
+  @now::timestamp,
+  @now::timestamp,
+  item.title,
+  item.url,
+  item.description,
+  NULLIF(item.published_at, '')::timestamp,
+  @feed_id::uuid,
+  item.guid,
+  item.author,
+  item.content,
+  item.thumbnail_url,
+  item.dedup_key,
+  item.raw_description,
+  item.raw_content,
+  item.excerpt
+FROM unnest(
+  @ids::uuid[],
+  @titles::text[],
+  @urls::text[],
+  @descriptions::text[],
+  @published_ats::text[],
+  @guids::text[],
+  @authors::text[],
+  @contents::text[],
+  @thumbnail_urls::text[],
+  @dedup_keys::text[],
+  @raw_descriptions::text[],
+  @raw_contents::text[],
+  @excerpts::text[]
+) AS item(
+  id,
+  title,
+  url,
+  description,
+  published_at,
+  guid,
+  author,
+  content,
+  thumbnail_url,
+  dedup_key,
+  raw_description,
+  raw_content,
+  excerpt
+)
+ON CONFLICT (feed_id, dedup_key) DO UPDATE
+SET title = EXCLUDED.title,
+url = EXCLUDED.url,
+description = EXCLUDED.description,
+published_at = COALESCE(EXCLUDED.published_at, posts.published_at),
+guid = EXCLUDED.guid,
+author = EXCLUDED.author,
+content = EXCLUDED.content,
+thumbnail_url = EXCLUDED.thumbnail_url,
+raw_description = EXCLUDED.raw_description,
+raw_content = EXCLUDED.raw_content,
+excerpt = EXCLUDED.excerpt,
+updated_at = EXCLUDED.updated_at
+WHERE (posts.title, posts.url, posts.raw_description, posts.author, posts.raw_content, posts.thumbnail_url)
+IS DISTINCT FROM
+(EXCLUDED.title, EXCLUDED.url, EXCLUDED.raw_description, EXCLUDED.author, EXCLUDED.raw_content, EXCLUDED.thumbnail_url)
+OR (posts.description, posts.content) IS DISTINCT FROM (EXCLUDED.description, EXCLUDED.content)
+OR (EXCLUDED.published_at IS NOT NULL AND EXCLUDED.published_at IS DISTINCT FROM posts.published_at)
+RETURNING id, title, dedup_key, (xmax = 0) AS inserted;
+
+-- name: AdoptLegacyPostKeys :exec
+UPDATE posts
+SET dedup_key = item.dedup_key
+FROM unnest(@legacy_keys::text[], @dedup_keys::text[]) AS item(legacy_key, dedup_key)
+WHERE posts.feed_id = @feed_id::uuid
+AND posts.guid = ''
+AND posts.dedup_key = item.legacy_key
+AND NOT EXISTS (
+  SELECT 1 FROM posts AS existing
+  WHERE existing.feed_id = @feed_id::uuid
+  AND existing.dedup_key = item.dedup_key
+);
+
+-- name: DeletePostCategories :exec
+DELETE FROM post_categories
+WHERE post_id = ANY(@post_ids::uuid[]);
+
+-- name: DeletePostEnclosures :exec
+DELETE FROM post_enclosures
+WHERE post_id = ANY(@post_ids::uuid[]);
+
+-- name: CreatePostCategories :exec
+INSERT INTO post_categories (post_id, name)
+SELECT category.post_id, category.name
+FROM unnest(@post_ids::uuid[], @names::text[]) AS category(post_id, name)
+ON CONFLICT DO NOTHING;
+
+-- name: CreatePostEnclosures :exec
+INSERT INTO post_enclosures (id, post_id, url, type, length)
+SELECT enclosure.id, enclosure.post_id, enclosure.url, enclosure.type, enclosure.length
+FROM unnest(
+  @ids::uuid[],
+  @post_ids::uuid[],
+  @urls::text[],
+  @types::text[],
+  @lengths::bigint[]
+) AS enclosure(id, post_id, url, type, length)
+ON CONFLICT (post_id, url) DO NOTHING;
+
+-- name: GetPostsForUser :many
+SELECT posts.* FROM posts
 JOIN feed_follows ON feed_follows.feed_id = posts.feed_id
 WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
+ORDER BY posts.published_at DESC NULLS LAST, posts.created_at DESC
 LIMIT $2;
+
+-- name: GetPostCategories :many
+SELECT * FROM post_categories
+WHERE post_id = ANY(@post_ids::uuid[])
+ORDER BY post_id, name;
+
+-- name: GetPostEnclosures :many
+SELECT * FROM post_enclosures
+WHERE post_id = ANY(@post_ids::uuid[])
+ORDER BY post_id, url;
+
+-- name: MovePosts :exec
+UPDATE posts
+SET feed_id = @into_feed_id::uuid,
+updated_at = NOW()
+WHERE feed_id = @from_feed_id::uuid
+AND NOT EXISTS (
+  SELECT 1 FROM posts AS existing
+  WHERE existing.feed_id = @into_feed_id::uuid
+  AND existing.dedup_key = posts.dedup_key
+);
+
+-- name: DeletePost :one
+DELETE FROM posts WHERE id = $1
+RETURNING *;
+
+-- name: QueuePostsForExtraction :exec
+UPDATE posts
+SET extraction_status = 'pending'
+WHERE id = ANY(@ids::uuid[]);
+
+-- name: ClaimPendingExtractions :many
+UPDATE posts
+SET extraction_lease_expires_at = NOW() + @lease_seconds::float8 * INTERVAL '1 second',
+extraction_attempts = extraction_attempts + 1
+WHERE id IN (
+  SELECT id FROM posts
+  WHERE extraction_status = 'pending'
+  AND (extraction_lease_expires_at IS NULL OR extraction_lease_expires_at <= NOW())
+  ORDER BY created_at ASC
+  LIMIT @max_posts
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteExtraction :exec
+UPDATE posts
+SET full_content = $2,
+extraction_status = 'done',
+extraction_error = '',
+extraction_lease_expires_at = NULL,
+extracted_at = NOW()
+WHERE id = $1;
+
+-- name: FailExtraction :exec
+UPDATE posts
+SET extraction_error = @extraction_error,
+extraction_status = CASE
+  WHEN extraction_attempts >= @max_attempts::integer THEN 'failed'
+  ELSE 'pending'
+END,
+extraction_lease_expires_at = NOW() + @retry_delay_seconds::float8 * INTERVAL '1 second'
+WHERE id = @id;
+
+-- name: GetUnsanitizedPosts :many
+SELECT posts.id, posts.url, posts.raw_description, posts.raw_content, feeds.url AS feed_url
+FROM posts
+JOIN feeds ON feeds.id = posts.feed_id
+WHERE NOT posts.html_sanitized
+LIMIT $1;
+
+-- name: SetPostSanitizedHTML :exec
+UPDATE posts
+SET description = $2,
+content = $3,
+excerpt = $4,
+html_sanitized = TRUE
+WHERE id = $1;
@@ -11,3 +11,33 @@ RETURNING *;
 -- name: GetUser :one
 SELECT * FROM users WHERE apikey = $1;
 
+
+-- name: UpdateUser :one
+UPDATE users
+SET name = $2,
+preferences = $3,
+updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1;
+
+-- name: ListUsers :many
+SELECT id, created_at, updated_at, name, is_admin, disabled_at FROM users
+ORDER BY created_at ASC
+LIMIT $1 OFFSET $2;
+
+-- name: SetUserDisabledAt :one
+UPDATE users
+SET disabled_at = $2,
+updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, name, is_admin, disabled_at;
+
+-- name: PromoteUsersToAdmin :many
+UPDATE users
+SET is_admin = TRUE,
+updated_at = NOW()
+WHERE id = ANY(@ids::uuid[]) AND NOT is_admin
+RETURNING id;
@@ -0,0 +1,25 @@
+-- +goose Up
+ALTER TABLE feeds
+  DROP CONSTRAINT feeds_user_id_fkey;
+ALTER TABLE feeds
+  RENAME COLUMN user_id TO created_by;
+ALTER TABLE feeds
+  ALTER COLUMN created_by DROP NOT NULL;
+ALTER TABLE feeds
+  ADD CONSTRAINT feeds_created_by_fkey
+  FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE feeds
+  ADD COLUMN orphaned_at TIMESTAMP;
+-- +goose Down
+ALTER TABLE feeds
+  DROP COLUMN orphaned_at;
+DELETE FROM feeds WHERE created_by IS NULL;
+ALTER TABLE feeds
+  DROP CONSTRAINT feeds_created_by_fkey;
+ALTER TABLE feeds
+  ALTER COLUMN created_by SET NOT NULL;
+ALTER TABLE feeds
+  RENAME COLUMN created_by TO user_id;
+ALTER TABLE feeds
+  ADD CONSTRAINT feeds_user_id_fkey
+  FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE users
+  ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users
+  ADD COLUMN disabled_at TIMESTAMP;
+ALTER TABLE feeds
+  ADD COLUMN disabled_at TIMESTAMP;
+ALTER TABLE feeds
+  ADD COLUMN last_fetch_error TEXT;
+-- +goose Down
+ALTER TABLE feeds
+  DROP COLUMN last_fetch_error;
+ALTER TABLE feeds
+  DROP COLUMN disabled_at;
+ALTER TABLE users
+  DROP COLUMN disabled_at;
+ALTER TABLE users
+  DROP COLUMN is_admin;
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE audit_log (
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+  action TEXT NOT NULL,
+  target_type TEXT NOT NULL,
+  target_id UUID,
+  details JSONB NOT NULL DEFAULT '{}'
+);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+-- +goose Down
+DROP TABLE audit_log;
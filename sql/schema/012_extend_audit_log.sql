@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE audit_log
+  ADD COLUMN request_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE audit_log
+  ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE audit_log
+  ADD COLUMN before JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE audit_log
+  ADD COLUMN after JSONB NOT NULL DEFAULT '{}';
+CREATE INDEX audit_log_actor_id_idx ON audit_log (actor_id, created_at);
+CREATE INDEX audit_log_target_idx ON audit_log (target_type, target_id);
+-- +goose Down
+DROP INDEX audit_log_target_idx;
+DROP INDEX audit_log_actor_id_idx;
+ALTER TABLE audit_log
+  DROP COLUMN after;
+ALTER TABLE audit_log
+  DROP COLUMN before;
+ALTER TABLE audit_log
+  DROP COLUMN ip;
+ALTER TABLE audit_log
+  DROP COLUMN request_id;
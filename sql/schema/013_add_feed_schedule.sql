@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE feeds
+  ADD COLUMN fetch_interval_seconds INTEGER NOT NULL DEFAULT 1800;
+ALTER TABLE feeds
+  ADD COLUMN next_fetch_at TIMESTAMP;
+CREATE INDEX feeds_next_fetch_at_idx ON feeds (next_fetch_at NULLS FIRST);
+-- +goose Down
+DROP INDEX feeds_next_fetch_at_idx;
+ALTER TABLE feeds
+  DROP COLUMN next_fetch_at;
+ALTER TABLE feeds
+  DROP COLUMN fetch_interval_seconds;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE feeds
+  ADD COLUMN lease_owner TEXT;
+ALTER TABLE feeds
+  ADD COLUMN lease_expires_at TIMESTAMP;
+-- +goose Down
+ALTER TABLE feeds
+  DROP COLUMN lease_expires_at;
+ALTER TABLE feeds
+  DROP COLUMN lease_owner;
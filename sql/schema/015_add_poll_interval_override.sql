@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE feed_follows
+  ADD COLUMN poll_interval_seconds INTEGER;
+-- +goose Down
+ALTER TABLE feed_follows
+  DROP COLUMN poll_interval_seconds;
@@ -0,0 +1,6 @@
+-- +goose Up
+ALTER TABLE feeds
+  ADD COLUMN last_parse_repair TEXT;
+-- +goose Down
+ALTER TABLE feeds
+  DROP COLUMN last_parse_repair;
@@ -0,0 +1,29 @@
+-- +goose Up
+ALTER TABLE posts
+  ADD COLUMN guid TEXT NOT NULL DEFAULT '',
+  ADD COLUMN author TEXT NOT NULL DEFAULT '',
+  ADD COLUMN content TEXT NOT NULL DEFAULT '',
+  ADD COLUMN thumbnail_url TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE post_categories (
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  PRIMARY KEY (post_id, name)
+);
+
+CREATE TABLE post_enclosures (
+  id UUID PRIMARY KEY,
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  url TEXT NOT NULL,
+  type TEXT NOT NULL DEFAULT '',
+  length BIGINT NOT NULL DEFAULT 0,
+  UNIQUE (post_id, url)
+);
+-- +goose Down
+DROP TABLE post_enclosures;
+DROP TABLE post_categories;
+ALTER TABLE posts
+  DROP COLUMN guid,
+  DROP COLUMN author,
+  DROP COLUMN content,
+  DROP COLUMN thumbnail_url;
@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE posts
+  DROP CONSTRAINT posts_url_key,
+  ADD COLUMN dedup_key TEXT;
+
+UPDATE posts SET dedup_key = CASE
+  WHEN guid <> '' THEN 'guid:' || guid
+  WHEN url <> '' THEN 'link:' || url
+  ELSE 'hash:' || md5(title || E'\n' || description)
+END;
+
+ALTER TABLE posts
+  ALTER COLUMN dedup_key SET NOT NULL,
+  ADD CONSTRAINT posts_feed_id_dedup_key_key UNIQUE (feed_id, dedup_key);
+-- +goose Down
+DELETE FROM posts a USING posts b
+WHERE a.url = b.url AND (a.created_at, a.id) > (b.created_at, b.id);
+
+ALTER TABLE posts
+  DROP CONSTRAINT posts_feed_id_dedup_key_key,
+  DROP COLUMN dedup_key,
+  ADD CONSTRAINT posts_url_key UNIQUE (url);
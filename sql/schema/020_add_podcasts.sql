@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE podcast_episodes (
+  post_id UUID PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+  duration_seconds INTEGER NOT NULL DEFAULT 0,
+  episode INTEGER NOT NULL DEFAULT 0,
+  season INTEGER NOT NULL DEFAULT 0,
+  explicit BOOLEAN NOT NULL DEFAULT FALSE,
+  artwork_url TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE playback_positions (
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  position_seconds INTEGER NOT NULL,
+  completed BOOLEAN NOT NULL DEFAULT FALSE,
+  updated_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (user_id, post_id)
+);
+-- +goose Down
+DROP TABLE playback_positions;
+DROP TABLE podcast_episodes;
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE posts
+  ADD COLUMN raw_description TEXT NOT NULL DEFAULT '',
+  ADD COLUMN raw_content TEXT NOT NULL DEFAULT '',
+  ADD COLUMN excerpt TEXT NOT NULL DEFAULT '';
+
+UPDATE posts SET raw_description = description, raw_content = content;
+-- +goose Down
+ALTER TABLE posts
+  DROP COLUMN raw_description,
+  DROP COLUMN raw_content,
+  DROP COLUMN excerpt;
@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE feeds
+  ADD COLUMN fetch_full_content BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE posts
+  ADD COLUMN full_content TEXT NOT NULL DEFAULT '',
+  ADD COLUMN extraction_status TEXT NOT NULL DEFAULT '',
+  ADD COLUMN extraction_error TEXT NOT NULL DEFAULT '',
+  ADD COLUMN extraction_attempts INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN extraction_lease_expires_at TIMESTAMP,
+  ADD COLUMN extracted_at TIMESTAMP;
+
+CREATE INDEX posts_extraction_pending_idx ON posts (created_at)
+  WHERE extraction_status = 'pending';
+-- +goose Down
+DROP INDEX posts_extraction_pending_idx;
+
+ALTER TABLE posts
+  DROP COLUMN full_content,
+  DROP COLUMN extraction_status,
+  DROP COLUMN extraction_error,
+  DROP COLUMN extraction_attempts,
+  DROP COLUMN extraction_lease_expires_at,
+  DROP COLUMN extracted_at;
+
+ALTER TABLE feeds
+  DROP COLUMN fetch_full_content;
@@ -0,0 +1,4 @@
+-- +goose Up
+CREATE INDEX posts_feed_id_published_at_idx ON posts (feed_id, published_at DESC NULLS LAST);
+-- +goose Down
+DROP INDEX posts_feed_id_published_at_idx;
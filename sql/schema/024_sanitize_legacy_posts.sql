@@ -0,0 +1,16 @@
+-- +goose Up
+-- Posts stored before raw HTML was kept were copied into raw_description and
+-- raw_content unsanitized and without an excerpt. The scraper sanitizes them
+-- in the background; until then the API does it when serving them.
+ALTER TABLE posts
+  ADD COLUMN html_sanitized BOOLEAN NOT NULL DEFAULT TRUE;
+
+UPDATE posts SET html_sanitized = FALSE
+WHERE excerpt = '' AND description = raw_description AND content = raw_content;
+
+CREATE INDEX posts_unsanitized_idx ON posts (id) WHERE NOT html_sanitized;
+-- +goose Down
+DROP INDEX posts_unsanitized_idx;
+
+ALTER TABLE posts
+  DROP COLUMN html_sanitized;